@@ -0,0 +1,152 @@
+package req
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Authenticator applies the credential to the requests and refreshes it
+// when the server rejects it
+type Authenticator interface {
+	// Authenticate applies the current credential to the request
+	Authenticate(req *http.Request) error
+	// Refresh invalidates the current credential and obtains a new one
+	Refresh(ctx context.Context) error
+}
+
+// NewAuthenticator create an authenticator from the functions
+func NewAuthenticator(apply func(req *http.Request) error, refresh func(ctx context.Context) error) Authenticator {
+	return &funcAuthenticator{apply: apply, refresh: refresh}
+}
+
+type funcAuthenticator struct {
+	apply   func(req *http.Request) error
+	refresh func(ctx context.Context) error
+}
+
+func (a *funcAuthenticator) Authenticate(req *http.Request) error {
+	return a.apply(req)
+}
+
+func (a *funcAuthenticator) Refresh(ctx context.Context) error {
+	return a.refresh(ctx)
+}
+
+// tokenAuthenticator the authenticator of the OAuth2 tokens
+type tokenAuthenticator struct {
+	cache *TokenCache
+}
+
+func (a *tokenAuthenticator) Authenticate(req *http.Request) error {
+	token, err := a.cache.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set(HeaderAuthorization, token.Type()+" "+token.AccessToken)
+	return nil
+}
+
+func (a *tokenAuthenticator) Refresh(ctx context.Context) error {
+	a.cache.Invalidate()
+	_, err := a.cache.Token(ctx)
+	return err
+}
+
+// reauth replays the request once after refreshing the credential
+// rejected by a 401 challenge, the requests rejected with the same
+// credential share a single refresh
+type reauth struct {
+	auth Authenticator
+	mu   sync.Mutex
+	gen  uint64
+	call *refreshCall
+}
+
+type refreshCall struct {
+	done chan struct{}
+	err  error
+}
+
+func newAuthMiddleware(a Authenticator) Middleware {
+	ra := &reauth{auth: a}
+	return ra.middleware
+}
+
+func (ra *reauth) generation() uint64 {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	return ra.gen
+}
+
+// refresh refreshes the credential of the generation, it returns at once
+// if the credential was already refreshed
+func (ra *reauth) refresh(ctx context.Context, gen uint64) error {
+	ra.mu.Lock()
+	if ra.gen != gen {
+		ra.mu.Unlock()
+		return nil
+	}
+
+	// the shared refresh isn't canceled with the request starting it
+	call := ra.call
+	if call == nil {
+		call = &refreshCall{done: make(chan struct{})}
+		ra.call = call
+		go ra.run(detachContext(ctx), call)
+	}
+	ra.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (ra *reauth) run(ctx context.Context, call *refreshCall) {
+	defer close(call.done)
+	defer func() {
+		ra.mu.Lock()
+		if call.err == nil {
+			ra.gen++
+		}
+		ra.call = nil
+		ra.mu.Unlock()
+	}()
+	call.err = ra.auth.Refresh(ctx)
+}
+
+func (ra *reauth) send(next Handler, req *http.Request) (*http.Response, uint64, error) {
+	gen := ra.generation()
+	areq := req.Clone(req.Context())
+	if err := ra.auth.Authenticate(areq); err != nil {
+		return nil, gen, err
+	}
+	resp, err := next(areq)
+	return resp, gen, err
+}
+
+func (ra *reauth) middleware(next Handler) Handler {
+	return func(req *http.Request) (*http.Response, error) {
+		resp, gen, err := ra.send(next, req)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized ||
+			resp.Header.Get(HeaderWWWAuthenticate) == "" || !canRewindBody(req) {
+			return resp, err
+		}
+
+		if err := ra.refresh(req.Context(), gen); err != nil {
+			// keep the 401 response if the credential can't be refreshed
+			return resp, nil
+		}
+		drainBody(resp.Body)
+
+		req, err = rewindRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		resp, _, err = ra.send(next, req)
+		return resp, err
+	}
+}
@@ -0,0 +1,122 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuthenticator(t *testing.T) {
+	var (
+		valid int32 = 1
+		hits  int32
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if r.URL.Path == "/deny" || r.Header.Get(HeaderAuthorization) != fmt.Sprintf("key-%d", atomic.LoadInt32(&valid)) {
+			w.Header().Set(HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s", r.Header.Get(HeaderAuthorization), body)
+	}))
+	defer ts.Close()
+
+	var (
+		mu        sync.Mutex
+		key       int32 = 1
+		refreshed int32
+	)
+	auth := NewAuthenticator(func(req *http.Request) error {
+		mu.Lock()
+		defer mu.Unlock()
+		req.Header.Set(HeaderAuthorization, fmt.Sprintf("key-%d", key))
+		return nil
+	}, func(ctx context.Context) error {
+		atomic.AddInt32(&refreshed, 1)
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		key = atomic.LoadInt32(&valid)
+		return nil
+	})
+
+	Convey("Test Authenticator", t, func() {
+		r := New(SetAuthenticator(auth))
+
+		resp, err := r.Post(context.Background(), ts.URL, strings.NewReader("foo"))
+		So(err, ShouldBeNil)
+		body, _ := resp.String()
+		So(body, ShouldEqual, "key-1 foo")
+		So(atomic.LoadInt32(&refreshed), ShouldEqual, 0)
+
+		// revoke the key, the concurrent requests share a single refresh
+		atomic.StoreInt32(&valid, 2)
+
+		var wg sync.WaitGroup
+		bodies := make([]string, 10)
+		for i := range bodies {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				resp, err := r.Post(context.Background(), ts.URL, strings.NewReader("bar"))
+				if err == nil {
+					bodies[i], _ = resp.String()
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		So(atomic.LoadInt32(&refreshed), ShouldEqual, 1)
+		for _, body := range bodies {
+			So(body, ShouldEqual, "key-2 bar")
+		}
+
+		// the request is replayed once at most
+		atomic.StoreInt32(&hits, 0)
+		resp, err = r.Get(context.Background(), ts.URL+"/deny", nil)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode(), ShouldEqual, http.StatusUnauthorized)
+		So(atomic.LoadInt32(&hits), ShouldEqual, 2)
+		So(atomic.LoadInt32(&refreshed), ShouldEqual, 2)
+	})
+	Convey("Test Authenticator Canceled Request", t, func() {
+		atomic.StoreInt32(&valid, 3)
+		var current int32 = 2
+		auth := NewAuthenticator(func(req *http.Request) error {
+			req.Header.Set(HeaderAuthorization, fmt.Sprintf("key-%d", atomic.LoadInt32(&current)))
+			return nil
+		}, func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(50 * time.Millisecond):
+			}
+			atomic.StoreInt32(&current, atomic.LoadInt32(&valid))
+			return nil
+		})
+		r := New(SetAuthenticator(auth))
+
+		// the request starting the refresh gives up
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		go r.Get(ctx, ts.URL, nil)
+		time.Sleep(10 * time.Millisecond)
+
+		// the other requests still get the refreshed credential
+		resp, err := r.Post(context.Background(), ts.URL, strings.NewReader("baz"))
+		So(err, ShouldBeNil)
+		body, _ := resp.String()
+		So(body, ShouldEqual, "key-3 baz")
+	})
+}
@@ -0,0 +1,348 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BalanceStrategy the strategy picking the endpoint of a request
+type BalanceStrategy int
+
+// Balance strategies
+const (
+	// RoundRobin picks the endpoints in turn
+	RoundRobin BalanceStrategy = iota
+	// Random picks a random endpoint
+	Random
+	// LeastOutstanding picks the endpoint with the fewest requests in flight
+	LeastOutstanding
+	// ConsistentHash picks the endpoint by the hash of the request path,
+	// the same path goes to the same endpoint while it's available
+	ConsistentHash
+)
+
+// hashReplicas the virtual nodes of an endpoint on the hash ring
+const hashReplicas = 100
+
+// NewBalancer create the balancer of the base URLs, an endpoint is ejected
+// for 30s after 5 consecutive failures
+func NewBalancer(strategy BalanceStrategy, baseURLs ...string) *Balancer {
+	b := &Balancer{
+		Strategy:    strategy,
+		MaxFailures: 5,
+		EjectTime:   30 * time.Second,
+	}
+	for _, u := range baseURLs {
+		b.endpoints = append(b.endpoints, &endpoint{base: u, healthy: true})
+	}
+
+	for i, e := range b.endpoints {
+		for j := 0; j < hashReplicas; j++ {
+			b.ring = append(b.ring, hashNode{
+				hash:  crc32.ChecksumIEEE([]byte(e.base + "#" + strconv.Itoa(j))),
+				index: i,
+			})
+		}
+	}
+	sort.Slice(b.ring, func(i, j int) bool { return b.ring[i].hash < b.ring[j].hash })
+	return b
+}
+
+// Balancer balances the requests with a relative URL across the base URLs,
+// the endpoints failing repeatedly are ejected for a while and the
+// attempts failing to connect fail over to another endpoint,
+// it's safe for concurrent use
+type Balancer struct {
+	Strategy BalanceStrategy
+	// HashKey returns the consistent hash key of the relative URL,
+	// the path without the query by default
+	HashKey func(urlStr string) string
+	// MaxFailures the consecutive failures ejecting an endpoint,
+	// zero disables the ejection
+	MaxFailures int
+	// EjectTime the time an ejected endpoint is skipped
+	EjectTime time.Duration
+
+	endpoints []*endpoint
+	ring      []hashNode
+	next      uint32
+	mu        sync.Mutex
+}
+
+type hashNode struct {
+	hash  uint32
+	index int
+}
+
+type endpoint struct {
+	base        string
+	outstanding int32
+	// the fields below are guarded by Balancer.mu
+	healthy      bool
+	failures     int
+	ejectedUntil time.Time
+}
+
+// EndpointStatus the status of a balanced endpoint
+type EndpointStatus struct {
+	URL         string `json:"url"`
+	Healthy     bool   `json:"healthy"`
+	Ejected     bool   `json:"ejected"`
+	Failures    int    `json:"failures"`
+	Outstanding int    `json:"outstanding"`
+}
+
+// Endpoints returns the status of the endpoints
+func (b *Balancer) Endpoints() []EndpointStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	list := make([]EndpointStatus, len(b.endpoints))
+	for i, e := range b.endpoints {
+		list[i] = EndpointStatus{
+			URL:         e.base,
+			Healthy:     e.healthy,
+			Ejected:     now.Before(e.ejectedUntil),
+			Failures:    e.failures,
+			Outstanding: int(atomic.LoadInt32(&e.outstanding)),
+		}
+	}
+	return list
+}
+
+// available returns the available endpoints not in tried, all the untried
+// endpoints if none is available, b.mu is held
+func (b *Balancer) available(tried map[*endpoint]bool) []int {
+	now := time.Now()
+	var list, untried []int
+	for i, e := range b.endpoints {
+		if tried[e] {
+			continue
+		}
+		untried = append(untried, i)
+		if e.healthy && !now.Before(e.ejectedUntil) {
+			list = append(list, i)
+		}
+	}
+	if len(list) == 0 {
+		return untried
+	}
+	return list
+}
+
+// pick picks the endpoint of the relative URL, nil if all are tried
+func (b *Balancer) pick(urlStr string, tried map[*endpoint]bool) *endpoint {
+	b.mu.Lock()
+	list := b.available(tried)
+	b.mu.Unlock()
+	if len(list) == 0 {
+		return nil
+	}
+
+	switch b.Strategy {
+	case Random:
+		return b.endpoints[list[rand.Intn(len(list))]]
+	case LeastOutstanding:
+		// start from the next endpoint in turn to spread the ties
+		start := int(atomic.AddUint32(&b.next, 1))
+		var best *endpoint
+		for i := range list {
+			e := b.endpoints[list[(start+i)%len(list)]]
+			if best == nil || atomic.LoadInt32(&e.outstanding) < atomic.LoadInt32(&best.outstanding) {
+				best = e
+			}
+		}
+		return best
+	case ConsistentHash:
+		ok := make(map[int]bool, len(list))
+		for _, i := range list {
+			ok[i] = true
+		}
+		h := crc32.ChecksumIEEE([]byte(b.hashKey(urlStr)))
+		start := sort.Search(len(b.ring), func(i int) bool { return b.ring[i].hash >= h })
+		for i := 0; i < len(b.ring); i++ {
+			if node := b.ring[(start+i)%len(b.ring)]; ok[node.index] {
+				return b.endpoints[node.index]
+			}
+		}
+	}
+	return b.endpoints[list[int(atomic.AddUint32(&b.next, 1)-1)%len(list)]]
+}
+
+func (b *Balancer) hashKey(urlStr string) string {
+	if b.HashKey != nil {
+		return b.HashKey(urlStr)
+	}
+	if i := strings.IndexByte(urlStr, '?'); i != -1 {
+		return urlStr[:i]
+	}
+	return urlStr
+}
+
+// done records the result of an attempt to the endpoint
+func (b *Balancer) done(e *endpoint, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		e.failures = 0
+		return
+	}
+	e.failures++
+	if b.MaxFailures > 0 && e.failures >= b.MaxFailures {
+		e.failures = 0
+		e.ejectedUntil = time.Now().Add(b.EjectTime)
+	}
+}
+
+// StartHealthCheck checks the path of every endpoint through the requester
+// at the interval, such as the requester the balancer is attached to for
+// its transport, TLS and proxy settings, the default requester if r is nil,
+// the endpoints not responding with a 2xx status are skipped until they do,
+// the returned function stops the checks
+func (b *Balancer) StartHealthCheck(r Requester, path string, interval time.Duration) (stop func()) {
+	if r == nil {
+		r = req()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	check := func() {
+		var wg sync.WaitGroup
+		for _, e := range b.endpoints {
+			wg.Add(1)
+			go func(e *endpoint) {
+				defer wg.Done()
+				cctx, ccancel := context.WithTimeout(ctx, interval)
+				defer ccancel()
+
+				healthy := false
+				if resp, err := r.Get(cctx, RequestURL(e.base, path), nil); err == nil {
+					healthy = resp.StatusCode() >= 200 && resp.StatusCode() < 300
+					drainBody(resp.Response().Body)
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				b.mu.Lock()
+				e.healthy = healthy
+				b.mu.Unlock()
+			}(e)
+		}
+		wg.Wait()
+	}
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			check()
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+	return cancel
+}
+
+// isAbsoluteURL reports whether the URL has a scheme
+func isAbsoluteURL(urlStr string) bool {
+	u, err := url.Parse(urlStr)
+	return err == nil && u.Scheme != ""
+}
+
+// isFailover reports whether the attempt failed before reaching the endpoint
+func isFailover(req *http.Request, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+	var oe *net.OpError
+	return errors.As(err, &oe) && oe.Op == "dial"
+}
+
+// middleware sends the attempts to the endpoints, the first attempt to
+// the endpoint picked for the URL and the retries to a new pick, the
+// attempts failing to connect fail over to the other endpoints
+func (b *Balancer) middleware(first *endpoint, urlStr string) Middleware {
+	var once sync.Once
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			var e *endpoint
+			once.Do(func() { e = first })
+
+			tried := make(map[*endpoint]bool)
+			for {
+				if e == nil {
+					if !canRewindBody(req) {
+						return nil, errNotRewindable
+					}
+					if e = b.pick(urlStr, tried); e == nil {
+						return nil, errors.New("req: no endpoint available")
+					}
+					u, err := url.Parse(RequestURL(e.base, urlStr))
+					if err != nil {
+						return nil, err
+					}
+					nreq, err := rewindRequest(req)
+					if err != nil {
+						return nil, err
+					}
+					nreq.URL, nreq.Host = u, ""
+					req = nreq
+				}
+				tried[e] = true
+
+				atomic.AddInt32(&e.outstanding, 1)
+				resp, err := next(req)
+				if err == nil {
+					b.done(e, resp.StatusCode >= http.StatusInternalServerError)
+					resp.Body = &endpointBody{ReadCloser: resp.Body, e: e}
+					return resp, nil
+				}
+				atomic.AddInt32(&e.outstanding, -1)
+
+				// the canceled and the rate limited attempts aren't recorded
+				var rle *RateLimitError
+				if req.Context().Err() != nil || errors.As(err, &rle) {
+					return nil, err
+				}
+				b.done(e, true)
+				if !isFailover(req, err) || !canRewindBody(req) || len(tried) >= len(b.endpoints) {
+					return nil, err
+				}
+				e = nil
+			}
+		}
+	}
+}
+
+// endpointBody ends the outstanding request of the endpoint
+// when the body is closed
+type endpointBody struct {
+	io.ReadCloser
+	e    *endpoint
+	once sync.Once
+}
+
+func (b *endpointBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { atomic.AddInt32(&b.e.outstanding, -1) })
+	return err
+}
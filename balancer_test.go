@@ -0,0 +1,169 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBalancer(t *testing.T) {
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, name+" "+r.URL.Path)
+		}))
+	}
+	ts1, ts2 := newServer("a"), newServer("b")
+	defer ts1.Close()
+	defer ts2.Close()
+
+	// the address refusing the connections
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := "http://" + l.Addr().String()
+	l.Close()
+
+	get := func(r Requester, path string) string {
+		resp, err := r.Get(context.Background(), path, nil)
+		So(err, ShouldBeNil)
+		body, _ := resp.String()
+		return body
+	}
+
+	Convey("Test Balancer Round Robin", t, func() {
+		r := New(SetBaseURLs(ts1.URL+"/v1", ts2.URL+"/v1"))
+		So(get(r, "/foo"), ShouldEqual, "a /v1/foo")
+		So(get(r, "/foo"), ShouldEqual, "b /v1/foo")
+		So(get(r, "/foo"), ShouldEqual, "a /v1/foo")
+
+		// the absolute urls aren't balanced
+		So(get(r, ts2.URL+"/bar"), ShouldEqual, "b /bar")
+	})
+
+	Convey("Test Balancer Consistent Hash", t, func() {
+		r := New(SetBalancer(NewBalancer(ConsistentHash, ts1.URL, ts2.URL)))
+		seen := make(map[string]bool)
+		for i := 0; i < 20; i++ {
+			path := fmt.Sprintf("/item/%d", i)
+			body := get(r, path+"?n=1")
+			So(get(r, path+"?n=2"), ShouldEqual, body)
+			seen[body[:1]] = true
+		}
+		So(seen, ShouldHaveLength, 2)
+	})
+
+	Convey("Test Balancer Least Outstanding", t, func() {
+		b := NewBalancer(LeastOutstanding, ts1.URL, ts2.URL)
+		r := New(SetBalancer(b))
+
+		// the unclosed response keeps its endpoint busy
+		resp, err := r.Get(context.Background(), "/foo", nil)
+		So(err, ShouldBeNil)
+		busy := b.Endpoints()
+		So(busy[0].Outstanding+busy[1].Outstanding, ShouldEqual, 1)
+
+		body := get(r, "/bar")
+		for _, e := range busy {
+			if e.Outstanding == 1 {
+				So(strings.HasPrefix(body, map[string]string{ts1.URL: "a", ts2.URL: "b"}[e.URL]), ShouldBeFalse)
+			}
+		}
+		resp.Response().Body.Close()
+		So(b.Endpoints()[0].Outstanding+b.Endpoints()[1].Outstanding, ShouldEqual, 0)
+	})
+
+	Convey("Test Balancer Failover And Ejection", t, func() {
+		b := NewBalancer(RoundRobin, down, ts1.URL)
+		b.MaxFailures = 2
+		r := New(SetBalancer(b))
+
+		for i := 0; i < 4; i++ {
+			So(get(r, "/foo"), ShouldEqual, "a /foo")
+		}
+		status := b.Endpoints()
+		So(status[0].Ejected, ShouldBeTrue)
+		So(status[1].Ejected, ShouldBeFalse)
+
+		// all the endpoints are down
+		r = New(SetBaseURLs(down, down))
+		_, err := r.Get(context.Background(), "/foo", nil)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test Balancer Non-Rewindable Body", t, func() {
+		twice := SetRequestMiddleware(func(next Handler) Handler {
+			return func(req *http.Request) (*http.Response, error) {
+				if resp, err := next(req); err == nil {
+					resp.Body.Close()
+				}
+				return next(req)
+			}
+		})
+		r := New(SetBaseURLs(ts1.URL, ts2.URL))
+
+		// the body read once can't be sent to another endpoint
+		_, err := r.Post(context.Background(), "/foo", ioutil.NopCloser(strings.NewReader("foo")), twice)
+		So(err, ShouldEqual, errNotRewindable)
+	})
+
+	Convey("Test Balancer Canceled Attempt", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/slow" {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer ts.Close()
+
+		b := NewBalancer(RoundRobin, ts.URL)
+		r := New(SetBalancer(b))
+		resp, err := r.Get(context.Background(), "/fail", nil)
+		So(err, ShouldBeNil)
+		resp.Close()
+		So(b.Endpoints()[0].Failures, ShouldEqual, 1)
+
+		// the canceled attempt keeps the failures
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = r.Get(ctx, "/slow", nil)
+		So(err, ShouldNotBeNil)
+		So(b.Endpoints()[0].Failures, ShouldEqual, 1)
+	})
+
+	Convey("Test Balancer Health Check", t, func() {
+		var healthy int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/health" && atomic.LoadInt32(&healthy) == 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, "c "+r.URL.Path)
+		}))
+		defer ts.Close()
+
+		b := NewBalancer(RoundRobin, ts.URL, ts1.URL)
+		r := New(SetBalancer(b))
+		stop := b.StartHealthCheck(r, "/health", 10*time.Millisecond)
+		defer stop()
+
+		time.Sleep(50 * time.Millisecond)
+		So(b.Endpoints()[0].Healthy, ShouldBeFalse)
+		for i := 0; i < 3; i++ {
+			So(get(r, "/foo"), ShouldEqual, "a /foo")
+		}
+
+		atomic.StoreInt32(&healthy, 1)
+		time.Sleep(50 * time.Millisecond)
+		So(b.Endpoints()[0].Healthy, ShouldBeTrue)
+	})
+}
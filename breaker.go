@@ -0,0 +1,283 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without sending the request
+// while the circuit of the host is open
+var ErrCircuitOpen = errors.New("req: circuit breaker is open")
+
+// CircuitState the state of a circuit
+type CircuitState int
+
+// Circuit states
+const (
+	// CircuitClosed the requests are sent
+	CircuitClosed CircuitState = iota
+	// CircuitOpen the requests fail with ErrCircuitOpen
+	CircuitOpen
+	// CircuitHalfOpen a few probe requests are sent
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+const circuitBuckets = 10
+
+// NewCircuitBreaker create the circuit breaker opening the circuit of a
+// host when half of at least 10 requests within 10s fail, the circuit is
+// half-open after 30s
+func NewCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{
+		Window:           10 * time.Second,
+		MinRequests:      10,
+		FailureRate:      0.5,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenRequests: 1,
+	}
+}
+
+// CircuitBreaker the circuit breaker with a circuit per host,
+// it's safe for concurrent use
+type CircuitBreaker struct {
+	// Key returns the circuit key of the request, the URL host by default
+	Key func(req *http.Request) string
+	// Window the rolling window of the failure rate
+	Window time.Duration
+	// MinRequests the requests within the window before the circuit can open
+	MinRequests int
+	// FailureRate the failure rate within the window opening the circuit
+	FailureRate float64
+	// OpenTimeout the time the circuit stays open before it's half-open
+	OpenTimeout time.Duration
+	// HalfOpenRequests the successful probes closing the half-open circuit
+	HalfOpenRequests int
+	// IsFailure reports whether the attempt failed, by default the
+	// transport errors, including the timeouts, and the 5xx responses,
+	// the canceled and the rate limited attempts don't count
+	IsFailure func(resp *http.Response, err error) bool
+	// OnStateChange is called when the circuit of the key changes its state
+	OnStateChange func(key string, from, to CircuitState)
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+	changes  []circuitChange
+}
+
+type circuitChange struct {
+	key      string
+	from, to CircuitState
+}
+
+type circuitBucket struct {
+	start    time.Time
+	requests int
+	failures int
+}
+
+type circuit struct {
+	state    CircuitState
+	openedAt time.Time
+	buckets  [circuitBuckets]circuitBucket
+	// probes the in-flight and successful requests of the half-open circuit
+	probes    int
+	successes int
+}
+
+func (b *CircuitBreaker) key(req *http.Request) string {
+	if b.Key != nil {
+		return b.Key(req)
+	}
+	return req.URL.Host
+}
+
+// isNeutral reports whether the attempt tells nothing about the host,
+// such as the canceled and the rate limited attempts
+func isNeutral(err error) bool {
+	var rle *RateLimitError
+	return errors.Is(err, context.Canceled) || errors.As(err, &rle)
+}
+
+func (b *CircuitBreaker) isFailure(resp *http.Response, err error) bool {
+	if fn := b.IsFailure; fn != nil {
+		return fn(resp, err)
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// State returns the state of the circuit of the key
+func (b *CircuitBreaker) State(key string) CircuitState {
+	b.mu.Lock()
+	defer b.unlock()
+
+	c, ok := b.circuits[key]
+	if !ok {
+		return CircuitClosed
+	}
+	b.expire(key, c, time.Now())
+	return c.state
+}
+
+// setState changes the state of the circuit, b.mu is held
+func (b *CircuitBreaker) setState(key string, c *circuit, state CircuitState, now time.Time) {
+	from := c.state
+	if from == state {
+		return
+	}
+
+	c.state = state
+	c.probes, c.successes = 0, 0
+	switch state {
+	case CircuitOpen:
+		c.openedAt = now
+	case CircuitClosed:
+		c.buckets = [circuitBuckets]circuitBucket{}
+	}
+	b.changes = append(b.changes, circuitChange{key: key, from: from, to: state})
+}
+
+// unlock releases b.mu and calls OnStateChange with the state changes
+func (b *CircuitBreaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+
+	if fn := b.OnStateChange; fn != nil {
+		for _, c := range changes {
+			fn(c.key, c.from, c.to)
+		}
+	}
+}
+
+// expire turns the open circuit to half-open after the timeout, b.mu is held
+func (b *CircuitBreaker) expire(key string, c *circuit, now time.Time) {
+	if c.state == CircuitOpen && now.Sub(c.openedAt) >= b.OpenTimeout {
+		b.setState(key, c, CircuitHalfOpen, now)
+	}
+}
+
+// allow reports whether the request can be sent
+func (b *CircuitBreaker) allow(key string) bool {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if b.circuits == nil {
+		b.circuits = make(map[string]*circuit)
+	}
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+
+	b.expire(key, c, time.Now())
+	switch c.state {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		if c.probes >= b.halfOpenRequests() {
+			return false
+		}
+		c.probes++
+	}
+	return true
+}
+
+func (b *CircuitBreaker) halfOpenRequests() int {
+	if b.HalfOpenRequests < 1 {
+		return 1
+	}
+	return b.HalfOpenRequests
+}
+
+// done records the result of the request
+func (b *CircuitBreaker) done(key string, failed bool) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	now := time.Now()
+	c := b.circuits[key]
+	switch c.state {
+	case CircuitHalfOpen:
+		if failed {
+			b.setState(key, c, CircuitOpen, now)
+			return
+		}
+		if c.successes++; c.successes >= b.halfOpenRequests() {
+			b.setState(key, c, CircuitClosed, now)
+		}
+	case CircuitClosed:
+		// the bucket of the current slice of the window
+		size := b.Window / circuitBuckets
+		if size <= 0 {
+			size = time.Second
+		}
+		start := now.Truncate(size)
+		bucket := &c.buckets[start.UnixNano()/int64(size)%circuitBuckets]
+		if !bucket.start.Equal(start) {
+			*bucket = circuitBucket{start: start}
+		}
+		bucket.requests++
+		if failed {
+			bucket.failures++
+		}
+
+		var requests, failures int
+		for _, v := range c.buckets {
+			if now.Sub(v.start) < size*circuitBuckets {
+				requests += v.requests
+				failures += v.failures
+			}
+		}
+		if failed && requests >= b.MinRequests && float64(failures) >= b.FailureRate*float64(requests) {
+			b.setState(key, c, CircuitOpen, now)
+		}
+	}
+}
+
+// release releases the probe slot of the neutral attempt
+// without changing the state
+func (b *CircuitBreaker) release(key string) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if c := b.circuits[key]; c.state == CircuitHalfOpen && c.probes > c.successes {
+		c.probes--
+	}
+}
+
+func (b *CircuitBreaker) middleware(next Handler) Handler {
+	return func(req *http.Request) (*http.Response, error) {
+		key := b.key(req)
+		if !b.allow(key) {
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, key)
+		}
+
+		resp, err := next(req)
+		if err != nil && (req.Context().Err() == context.Canceled || isNeutral(err)) {
+			b.release(key)
+			return resp, err
+		}
+		b.done(key, b.isFailure(resp, err))
+		return resp, err
+	}
+}
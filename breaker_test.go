@@ -0,0 +1,130 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		switch r.URL.Path {
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	other := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+
+	Convey("Test Circuit Breaker", t, func() {
+		var (
+			mu      sync.Mutex
+			changes []string
+		)
+		b := NewCircuitBreaker()
+		b.MinRequests = 4
+		b.OpenTimeout = 50 * time.Millisecond
+		b.OnStateChange = func(key string, from, to CircuitState) {
+			mu.Lock()
+			changes = append(changes, key+" "+from.String()+" "+to.String())
+			mu.Unlock()
+		}
+		r := New(SetCircuitBreaker(b), SetRetry(&Retry{Count: 2, WaitMin: time.Millisecond, WaitMax: time.Millisecond}))
+
+		for _, path := range []string{"/ok", "/ok"} {
+			_, err := r.Get(context.Background(), ts.URL+path, nil)
+			So(err, ShouldBeNil)
+		}
+		// the failed request is retried until the circuit opens
+		_, err := r.Get(context.Background(), ts.URL+"/fail", nil)
+		So(errors.Is(err, ErrCircuitOpen), ShouldBeTrue)
+		So(b.State(u.Host), ShouldEqual, CircuitOpen)
+		So(atomic.LoadInt32(&hits), ShouldEqual, 4)
+
+		_, err = r.Get(context.Background(), ts.URL+"/ok", nil)
+		So(errors.Is(err, ErrCircuitOpen), ShouldBeTrue)
+		So(atomic.LoadInt32(&hits), ShouldEqual, 4)
+
+		// the circuits of the other hosts are closed
+		_, err = r.Get(context.Background(), other+"/ok", nil)
+		So(err, ShouldBeNil)
+
+		// the failed probe opens the circuit again
+		time.Sleep(60 * time.Millisecond)
+		So(b.State(u.Host), ShouldEqual, CircuitHalfOpen)
+		_, err = r.Get(context.Background(), ts.URL+"/fail", nil, SetRequestRetry(nil))
+		So(err, ShouldBeNil)
+		So(b.State(u.Host), ShouldEqual, CircuitOpen)
+
+		time.Sleep(60 * time.Millisecond)
+		_, err = r.Get(context.Background(), ts.URL+"/ok", nil)
+		So(err, ShouldBeNil)
+		So(b.State(u.Host), ShouldEqual, CircuitClosed)
+
+		mu.Lock()
+		defer mu.Unlock()
+		So(changes, ShouldResemble, []string{
+			u.Host + " closed open",
+			u.Host + " open half-open",
+			u.Host + " half-open open",
+			u.Host + " open half-open",
+			u.Host + " half-open closed",
+		})
+	})
+
+	Convey("Test Circuit Breaker Neutral Probe", t, func() {
+		b := NewCircuitBreaker()
+		b.MinRequests = 1
+		b.OpenTimeout = 10 * time.Millisecond
+		r := New(SetCircuitBreaker(b))
+
+		_, err := r.Get(context.Background(), ts.URL+"/fail", nil)
+		So(err, ShouldBeNil)
+		So(b.State(u.Host), ShouldEqual, CircuitOpen)
+		time.Sleep(20 * time.Millisecond)
+
+		// the canceled probe leaves the circuit half-open
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		_, err = r.Get(ctx, ts.URL+"/slow", nil)
+		So(errors.Is(err, context.Canceled), ShouldBeTrue)
+		So(b.State(u.Host), ShouldEqual, CircuitHalfOpen)
+
+		_, err = r.Get(context.Background(), ts.URL+"/ok", nil)
+		So(err, ShouldBeNil)
+		So(b.State(u.Host), ShouldEqual, CircuitClosed)
+	})
+
+	Convey("Test Circuit Breaker Rate Limited", t, func() {
+		b := NewCircuitBreaker()
+		b.MinRequests = 1
+		r := New(SetCircuitBreaker(b), SetRateLimiter(NewRateLimiter(0.1, 1)))
+
+		_, err := r.Get(context.Background(), ts.URL+"/ok", nil)
+		So(err, ShouldBeNil)
+
+		// the wait for the rate limiter isn't an attempt to the host
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = r.Get(ctx, ts.URL+"/ok", nil)
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		So(b.State(u.Host), ShouldEqual, CircuitClosed)
+	})
+}
@@ -0,0 +1,408 @@
+package req
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCacheMaxEntrySize the default maximum body size of the cached
+// responses, the larger responses aren't buffered and stored
+const DefaultCacheMaxEntrySize = 10 << 20
+
+// cacheableStatus the status codes cacheable by default (RFC 7231 6.1)
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := make(cacheControl)
+	for _, v := range h[HeaderCacheControl] {
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			if i := strings.IndexByte(part, '='); i != -1 {
+				cc[strings.ToLower(strings.TrimSpace(part[:i]))] = strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+			} else {
+				cc[strings.ToLower(part)] = ""
+			}
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || sec < 0 {
+		return 0, false
+	}
+	return time.Duration(sec) * time.Second, true
+}
+
+// cacheEntry the stored response
+type cacheEntry struct {
+	Vary         map[string]string `json:"vary,omitempty"`
+	RequestTime  time.Time         `json:"request_time"`
+	ResponseTime time.Time         `json:"response_time"`
+	Response     []byte            `json:"response"`
+}
+
+func (e *cacheEntry) response(req *http.Request) (*http.Response, error) {
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(e.Response)), req)
+}
+
+func (e *cacheEntry) matchVary(req *http.Request) bool {
+	for k, v := range e.Vary {
+		if varyValue(req, k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// varyValue returns the value of the request header the response varies
+// on, the Authorization is hashed to keep the credentials out of the store
+func varyValue(req *http.Request, key string) string {
+	v := req.Header.Get(key)
+	if key == HeaderAuthorization && v != "" {
+		sum := sha256.Sum256([]byte(v))
+		return hex.EncodeToString(sum[:])
+	}
+	return v
+}
+
+type httpCache struct {
+	store        CacheStore
+	shared       bool
+	maxEntrySize int64
+}
+
+func newHTTPCache(store CacheStore, shared bool) *httpCache {
+	return &httpCache{store: store, shared: shared, maxEntrySize: DefaultCacheMaxEntrySize}
+}
+
+type cacheHitKey struct{}
+
+// cachedResponse marks the response served from the cache in the context
+// of its request, the response headers can't be trusted for it
+func cachedResponse(req *http.Request, resp *http.Response) *http.Response {
+	resp.Request = req.WithContext(context.WithValue(req.Context(), cacheHitKey{}, true))
+	return resp
+}
+
+// fromCache reports whether the response is served from the cache
+func fromCache(resp *http.Response) bool {
+	return resp.Request != nil && resp.Request.Context().Value(cacheHitKey{}) != nil
+}
+
+func cacheKey(req *http.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+func (c *httpCache) load(req *http.Request) (*cacheEntry, *http.Response) {
+	b, ok := c.store.Get(cacheKey(req))
+	if !ok {
+		return nil, nil
+	}
+
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil || !e.matchVary(req) {
+		return nil, nil
+	}
+	resp, err := e.response(req)
+	if err != nil {
+		return nil, nil
+	}
+	return &e, resp
+}
+
+// freshness returns the freshness lifetime and the current age of the entry
+func (c *httpCache) freshness(e *cacheEntry, resp *http.Response) (lifetime, age time.Duration) {
+	cc := parseCacheControl(resp.Header)
+
+	var ok bool
+	if c.shared {
+		lifetime, ok = cc.seconds("s-maxage")
+	}
+	if !ok {
+		lifetime, ok = cc.seconds("max-age")
+	}
+	if !ok {
+		if expires, err := http.ParseTime(resp.Header.Get(HeaderExpires)); err == nil {
+			date, err := http.ParseTime(resp.Header.Get("Date"))
+			if err != nil {
+				date = e.ResponseTime
+			}
+			lifetime = expires.Sub(date)
+		}
+	}
+
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		if d := e.ResponseTime.Sub(date); d > 0 {
+			age = d
+		}
+	}
+	if sec, err := strconv.ParseInt(resp.Header.Get("Age"), 10, 64); err == nil && sec > 0 {
+		if d := time.Duration(sec) * time.Second; d > age {
+			age = d
+		}
+	}
+	age += e.ResponseTime.Sub(e.RequestTime) + time.Since(e.ResponseTime)
+	return lifetime, age
+}
+
+func (c *httpCache) fresh(req *http.Request, e *cacheEntry, resp *http.Response, reqCC cacheControl) bool {
+	if reqCC.has("no-cache") || parseCacheControl(resp.Header).has("no-cache") {
+		return false
+	}
+	if len(reqCC) == 0 && req.Header.Get(HeaderPragma) == "no-cache" {
+		return false
+	}
+
+	lifetime, age := c.freshness(e, resp)
+	if maxAge, ok := reqCC.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := reqCC.seconds("min-fresh"); ok {
+		age += minFresh
+	}
+	return age < lifetime
+}
+
+func (c *httpCache) storable(req *http.Request, resp *http.Response) bool {
+	if req.Method != http.MethodGet || !cacheableStatus[resp.StatusCode] {
+		return false
+	}
+
+	reqCC, respCC := parseCacheControl(req.Header), parseCacheControl(resp.Header)
+	if reqCC.has("no-store") || respCC.has("no-store") {
+		return false
+	}
+	if strings.TrimSpace(resp.Header.Get(HeaderVary)) == "*" {
+		return false
+	}
+
+	if c.shared {
+		if respCC.has("private") {
+			return false
+		}
+		if req.Header.Get(HeaderAuthorization) != "" &&
+			!respCC.has("public") && !respCC.has("s-maxage") && !respCC.has("must-revalidate") {
+			return false
+		}
+	}
+
+	return respCC.has("max-age") || (c.shared && respCC.has("s-maxage")) ||
+		resp.Header.Get(HeaderExpires) != "" ||
+		resp.Header.Get(HeaderETag) != "" || resp.Header.Get(HeaderLastModified) != ""
+}
+
+func (c *httpCache) save(req *http.Request, resp *http.Response, body []byte, reqTime, respTime time.Time) {
+	e := &cacheEntry{
+		RequestTime:  reqTime,
+		ResponseTime: respTime,
+		// the response to one caller's credentials isn't served to another
+		Vary: map[string]string{HeaderAuthorization: varyValue(req, HeaderAuthorization)},
+	}
+	for _, v := range resp.Header[HeaderVary] {
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				k = http.CanonicalHeaderKey(k)
+				e.Vary[k] = varyValue(req, k)
+			}
+		}
+	}
+
+	stored := *resp
+	stored.Header = resp.Header.Clone()
+	stored.Body = ioutil.NopCloser(bytes.NewReader(body))
+	stored.ContentLength = int64(len(body))
+	stored.TransferEncoding = nil
+	stored.Trailer = nil
+
+	var buf bytes.Buffer
+	if err := stored.Write(&buf); err != nil {
+		return
+	}
+	e.Response = buf.Bytes()
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	c.store.Set(cacheKey(req), b)
+}
+
+// conditionalRequest returns the request revalidating the cached response,
+// nil if the response has no validator
+func conditionalRequest(req *http.Request, cached *http.Response) *http.Request {
+	etag, lastModified := cached.Header.Get(HeaderETag), cached.Header.Get(HeaderLastModified)
+	if etag == "" && lastModified == "" {
+		return nil
+	}
+	if req.Header.Get(HeaderIfNoneMatch) != "" || req.Header.Get(HeaderIfModifiedSince) != "" {
+		return nil
+	}
+
+	creq := req.Clone(req.Context())
+	if etag != "" {
+		creq.Header.Set(HeaderIfNoneMatch, etag)
+	}
+	if lastModified != "" {
+		creq.Header.Set(HeaderIfModifiedSince, lastModified)
+	}
+	return creq
+}
+
+func (c *httpCache) middleware(next Handler) Handler {
+	return func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodGet {
+			resp, err := next(req)
+			if err == nil && req.Method != http.MethodHead && req.Method != http.MethodOptions &&
+				resp.StatusCode < 400 {
+				// unsafe methods invalidate the cached response of the target
+				c.store.Delete(http.MethodGet + " " + req.URL.String())
+			}
+			return resp, err
+		}
+
+		reqCC := parseCacheControl(req.Header)
+		if reqCC.has("no-store") {
+			return next(req)
+		}
+		// the partial responses aren't cached, and a cached full response
+		// doesn't answer a range request
+		if req.Header.Get(HeaderRange) != "" || req.Header.Get(HeaderIfRange) != "" {
+			return next(req)
+		}
+
+		entry, cached := c.load(req)
+		if cached != nil && c.fresh(req, entry, cached, reqCC) {
+			return cachedResponse(req, cached), nil
+		}
+
+		if cached == nil && reqCC.has("only-if-cached") {
+			return &http.Response{
+				Status:     "504 Gateway Timeout",
+				StatusCode: http.StatusGatewayTimeout,
+				Proto:      "HTTP/1.1",
+				ProtoMajor: 1,
+				ProtoMinor: 1,
+				Header:     make(http.Header),
+				Body:       http.NoBody,
+				Request:    req,
+			}, nil
+		}
+
+		sendReq := req
+		if cached != nil {
+			if creq := conditionalRequest(req, cached); creq != nil {
+				sendReq = creq
+			}
+		}
+
+		reqTime := time.Now()
+		resp, err := next(sendReq)
+		if err != nil {
+			return nil, err
+		}
+		respTime := time.Now()
+
+		if cached != nil && sendReq != req && resp.StatusCode == http.StatusNotModified {
+			drainBody(resp.Body)
+			for k, v := range resp.Header {
+				if k == HeaderContentLength || k == HeaderTransferEncoding {
+					continue
+				}
+				cached.Header[k] = v
+			}
+
+			body, err := ioutil.ReadAll(cached.Body)
+			if err != nil {
+				return nil, err
+			}
+			cached.Body.Close()
+			if c.storable(req, cached) {
+				c.save(req, cached, body, reqTime, respTime)
+			}
+
+			cached.Body = ioutil.NopCloser(bytes.NewReader(body))
+			return cachedResponse(req, cached), nil
+		}
+
+		if cached != nil {
+			cached.Body.Close()
+		}
+		if !c.storable(req, resp) || resp.ContentLength > c.maxEntrySize {
+			return resp, nil
+		}
+
+		resp.Body = &cacheBody{
+			ReadCloser: resp.Body,
+			max:        c.maxEntrySize,
+			save: func(body []byte) {
+				c.save(req, resp, body, reqTime, respTime)
+			},
+		}
+		return resp, nil
+	}
+}
+
+// cacheBody saves the response body once it has been read to the end,
+// the body larger than max isn't buffered and saved
+type cacheBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	max  int64
+	save func(body []byte)
+	done bool
+}
+
+func (b *cacheBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.done {
+		return n, err
+	}
+	if int64(b.buf.Len()+n) > b.max {
+		b.done = true
+		b.buf = bytes.Buffer{}
+		return n, err
+	}
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.done = true
+		b.save(b.buf.Bytes())
+	}
+	return n, err
+}
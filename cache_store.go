@@ -0,0 +1,134 @@
+package req
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheStore the storage of the cached responses
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+var (
+	_ CacheStore = &MemoryCache{}
+	_ CacheStore = &DiskCache{}
+)
+
+// NewMemoryCache create an in-memory LRU cache store holding up to
+// maxBytes of entries
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// MemoryCache the in-memory LRU cache store
+type MemoryCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	value []byte
+}
+
+// Get get the cached value and mark it as recently used
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*memoryCacheItem).value, true
+}
+
+// Set set the cached value, evicting the least recently used values
+// when the cache is full
+func (c *MemoryCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.removeElement(e)
+	}
+	if int64(len(value)) > c.maxBytes {
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&memoryCacheItem{key: key, value: value})
+	c.size += int64(len(value))
+	for c.size > c.maxBytes {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Delete delete the cached value
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.removeElement(e)
+	}
+}
+
+func (c *MemoryCache) removeElement(e *list.Element) {
+	item := c.ll.Remove(e).(*memoryCacheItem)
+	delete(c.items, item.key)
+	c.size -= int64(len(item.value))
+}
+
+// NewDiskCache create a cache store keeping one file per entry in dir
+func NewDiskCache(dir string) *DiskCache {
+	return &DiskCache{dir: dir}
+}
+
+// DiskCache the on-disk cache store
+type DiskCache struct {
+	dir string
+}
+
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get get the cached value
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	b, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// Set set the cached value, errors are ignored as a cache miss
+func (c *DiskCache) Set(key string, value []byte) {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return
+	}
+	saveFile(c.path(key), bytes.NewReader(value))
+}
+
+// Delete delete the cached value
+func (c *DiskCache) Delete(key string) {
+	os.Remove(c.path(key))
+}
@@ -0,0 +1,124 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCache(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set(HeaderCacheControl, "max-age=60")
+			w.Header().Set(HeaderETag, `"v1"`)
+			w.Header().Set(HeaderVary, HeaderAcceptLanguage)
+			if r.Header.Get(HeaderIfNoneMatch) == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			fmt.Fprintf(w, "fresh %s", r.Header.Get(HeaderAcceptLanguage))
+		case "/auth":
+			w.Header().Set(HeaderCacheControl, "max-age=60")
+			fmt.Fprintf(w, "auth %s", r.Header.Get(HeaderAuthorization))
+		case "/large":
+			w.Header().Set(HeaderCacheControl, "max-age=60")
+			fmt.Fprint(w, strings.Repeat("a", 2048))
+		case "/private":
+			w.Header().Set(HeaderCacheControl, "private, max-age=60")
+			fmt.Fprint(w, "private")
+		default:
+			// the header sent by the server doesn't mark a cache hit
+			w.Header().Set("X-From-Cache", "1")
+			w.Header().Set(HeaderCacheControl, "no-store")
+			fmt.Fprint(w, "no-store")
+		}
+	}))
+	defer ts.Close()
+
+	get := func(r Requester, path string, opts ...RequestOption) (string, bool) {
+		resp, err := r.Get(context.Background(), ts.URL+path, nil, opts...)
+		So(err, ShouldBeNil)
+		body, err := resp.String()
+		So(err, ShouldBeNil)
+		return body, resp.FromCache()
+	}
+
+	dir, err := ioutil.TempDir("", "req")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Convey("Test Cache Request", t, func() {
+		for _, store := range []CacheStore{NewMemoryCache(1 << 20), NewDiskCache(dir)} {
+			r := New(SetCache(store))
+			atomic.StoreInt32(&count, 0)
+
+			body, hit := get(r, "/fresh")
+			So(body, ShouldEqual, "fresh ")
+			So(hit, ShouldBeFalse)
+
+			body, hit = get(r, "/fresh")
+			So(body, ShouldEqual, "fresh ")
+			So(hit, ShouldBeTrue)
+			So(atomic.LoadInt32(&count), ShouldEqual, 1)
+
+			body, hit = get(r, "/fresh", SetHeader(HeaderCacheControl, "no-cache"))
+			So(body, ShouldEqual, "fresh ")
+			So(hit, ShouldBeTrue)
+			So(atomic.LoadInt32(&count), ShouldEqual, 2)
+
+			body, hit = get(r, "/fresh", SetHeader(HeaderAcceptLanguage, "en"))
+			So(body, ShouldEqual, "fresh en")
+			So(hit, ShouldBeFalse)
+
+			_, hit = get(r, "/no-store")
+			So(hit, ShouldBeFalse)
+			_, hit = get(r, "/no-store")
+			So(hit, ShouldBeFalse)
+
+			// the responses to the other credentials aren't served
+			body, _ = get(r, "/auth", SetHeader(HeaderAuthorization, "Bearer alice"))
+			So(body, ShouldEqual, "auth Bearer alice")
+			body, hit = get(r, "/auth", SetHeader(HeaderAuthorization, "Bearer alice"))
+			So(body, ShouldEqual, "auth Bearer alice")
+			So(hit, ShouldBeTrue)
+			body, hit = get(r, "/auth", SetHeader(HeaderAuthorization, "Bearer bob"))
+			So(body, ShouldEqual, "auth Bearer bob")
+			So(hit, ShouldBeFalse)
+			_, hit = get(r, "/auth")
+			So(hit, ShouldBeFalse)
+
+			// the range requests skip the cache
+			n := atomic.LoadInt32(&count)
+			_, hit = get(r, "/fresh", SetHeader(HeaderRange, "bytes=0-1"))
+			So(hit, ShouldBeFalse)
+			So(atomic.LoadInt32(&count), ShouldEqual, n+1)
+		}
+
+		r := New(SetSharedCache(NewMemoryCache(1 << 20)))
+		_, hit := get(r, "/private")
+		So(hit, ShouldBeFalse)
+		_, hit = get(r, "/private")
+		So(hit, ShouldBeFalse)
+
+		// the bodies larger than the maximum entry size aren't stored
+		r = New(SetCache(NewMemoryCache(1<<20)), SetCacheMaxEntrySize(1024))
+		for i := 0; i < 2; i++ {
+			body, hit := get(r, "/large")
+			So(body, ShouldHaveLength, 2048)
+			So(hit, ShouldBeFalse)
+		}
+	})
+}
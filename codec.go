@@ -0,0 +1,151 @@
+package req
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Codec encodes and decodes the body of a content type
+type Codec interface {
+	// ContentType the Content-Type of the encoded body
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	_ Codec = JSONCodec{}
+	_ Codec = XMLCodec{}
+)
+
+// JSONCodec the application/json codec
+type JSONCodec struct{}
+
+// ContentType the Content-Type of the encoded body
+func (JSONCodec) ContentType() string {
+	return MIMEApplicationJSONCharsetUTF8
+}
+
+// Marshal encode v to json by json.Encoder, ending with a newline
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decode json data to v
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// XMLCodec the application/xml codec
+type XMLCodec struct{}
+
+// ContentType the Content-Type of the encoded body
+func (XMLCodec) ContentType() string {
+	return MIMEApplicationXMLCharsetUTF8
+}
+
+// Marshal encode v to xml
+func (XMLCodec) Marshal(v interface{}) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+// Unmarshal decode xml data to v
+func (XMLCodec) Unmarshal(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
+
+// codecRegistry the codecs keyed by media type
+type codecRegistry map[string]Codec
+
+var defaultCodecs = codecRegistry{
+	MIMEApplicationJSON: JSONCodec{},
+	MIMEApplicationXML:  XMLCodec{},
+	"text/xml":          XMLCodec{},
+}
+
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = contentType
+		if i := strings.IndexByte(mt, ';'); i != -1 {
+			mt = mt[:i]
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(mt))
+}
+
+// lookup finds the codec of the content type, structured syntax
+// suffixes such as application/problem+json fall back to the suffix codec
+func (c codecRegistry) lookup(contentType string) (Codec, error) {
+	mt := mediaType(contentType)
+	if codec, ok := c.get(mt); ok {
+		return codec, nil
+	}
+
+	if i := strings.LastIndexByte(mt, '+'); i != -1 {
+		if j := strings.IndexByte(mt, '/'); j != -1 && j < i {
+			if codec, ok := c.get(mt[:j+1] + mt[i+1:]); ok {
+				return codec, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("req: no codec registered for content type %q", contentType)
+}
+
+func (c codecRegistry) get(mt string) (Codec, bool) {
+	if codec, ok := c[mt]; ok {
+		return codec, true
+	}
+	codec, ok := defaultCodecs[mt]
+	return codec, ok
+}
+
+// PostBody post request encoded by the codec of the content type through
+// the requester, the default requester if r is nil
+func PostBody(ctx context.Context, r Requester, urlStr, contentType string, body interface{}, opts ...RequestOption) (Responser, error) {
+	return doBody(ctx, r, urlStr, http.MethodPost, contentType, body, opts...)
+}
+
+// PutBody put request encoded by the codec of the content type through
+// the requester, the default requester if r is nil
+func PutBody(ctx context.Context, r Requester, urlStr, contentType string, body interface{}, opts ...RequestOption) (Responser, error) {
+	return doBody(ctx, r, urlStr, http.MethodPut, contentType, body, opts...)
+}
+
+// doBody encodes the body by the codecs of the requester created by New,
+// or the built-in codecs
+func doBody(ctx context.Context, r Requester, urlStr, method, contentType string, body interface{}, opts ...RequestOption) (Responser, error) {
+	if r == nil {
+		r = req()
+	}
+	var codecs codecRegistry
+	if rr, ok := r.(*request); ok {
+		codecs = rr.opts.codecs
+	}
+
+	codec, err := codecs.lookup(contentType)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := codec.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var ro []RequestOption
+	ro = append(ro, SetContentType(contentType))
+	if len(opts) > 0 {
+		ro = append(ro, opts...)
+	}
+	return r.Do(ctx, urlStr, method, bytes.NewReader(buf), ro...)
+}
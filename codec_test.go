@@ -0,0 +1,51 @@
+package req
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCodec(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderContentType, r.Header.Get(HeaderContentType))
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	type item struct {
+		XMLName xml.Name `xml:"item" json:"-"`
+		Foo     string   `xml:"foo" json:"foo"`
+	}
+
+	Convey("Test Codec Request", t, func() {
+		r := New()
+
+		resp, err := PostBody(context.Background(), r, ts.URL, MIMEApplicationXML, item{Foo: "bar"})
+		So(err, ShouldBeNil)
+		var v item
+		So(resp.Decode(&v), ShouldBeNil)
+		So(v.Foo, ShouldEqual, "bar")
+
+		resp, err = PutBody(context.Background(), r, ts.URL, "application/vnd.foo+json", item{Foo: "bar"})
+		So(err, ShouldBeNil)
+		v = item{}
+		So(resp.Decode(&v), ShouldBeNil)
+		So(v.Foo, ShouldEqual, "bar")
+
+		// the other requesters use the built-in codecs
+		resp, err = PostBody(context.Background(), struct{ Requester }{r}, ts.URL, MIMEApplicationXML, item{Foo: "baz"})
+		So(err, ShouldBeNil)
+		So(resp.Decode(&v), ShouldBeNil)
+		So(v.Foo, ShouldEqual, "baz")
+
+		_, err = PostBody(context.Background(), r, ts.URL, MIMEApplicationMsgpack, item{Foo: "bar"})
+		So(err, ShouldNotBeNil)
+	})
+}
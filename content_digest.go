@@ -0,0 +1,241 @@
+package req
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Digest headers (RFC 9530)
+const (
+	HeaderContentDigest = "Content-Digest"
+	HeaderReprDigest    = "Repr-Digest"
+)
+
+// Digest algorithms (RFC 9530)
+const (
+	DigestSHA256 = "sha-256"
+	DigestSHA512 = "sha-512"
+)
+
+var contentDigestHashes = map[string]func() hash.Hash{
+	DigestSHA256: sha256.New,
+	DigestSHA512: sha512.New,
+}
+
+// DigestError is returned when reading a response body not matching its digest
+type DigestError struct {
+	// Header the digest header, such as Content-Digest
+	Header    string
+	Algorithm string
+	Expected  []byte
+	Actual    []byte
+}
+
+func (e *DigestError) Error() string {
+	return fmt.Sprintf("req: %s %s mismatch", e.Header, e.Algorithm)
+}
+
+// formatDigests formats the digest dictionary of the hashes in order
+func formatDigests(algorithms []string, hashes []hash.Hash) string {
+	list := make([]string, len(algorithms))
+	for i, alg := range algorithms {
+		list[i] = alg + "=:" + base64.StdEncoding.EncodeToString(hashes[i].Sum(nil)) + ":"
+	}
+	return strings.Join(list, ", ")
+}
+
+// parseDigests parses the digest dictionary, the unsupported
+// algorithms are skipped
+func parseDigests(value string) map[string][]byte {
+	digests := make(map[string][]byte)
+	for _, item := range strings.Split(value, ",") {
+		i := strings.IndexByte(item, '=')
+		if i <= 0 {
+			continue
+		}
+		alg := strings.ToLower(strings.TrimSpace(item[:i]))
+		v := strings.TrimSpace(item[i+1:])
+		if _, ok := contentDigestHashes[alg]; !ok || len(v) < 2 || v[0] != ':' || v[len(v)-1] != ':' {
+			continue
+		}
+		if sum, err := base64.StdEncoding.DecodeString(v[1 : len(v)-1]); err == nil {
+			digests[alg] = sum
+		}
+	}
+	return digests
+}
+
+// contentDigester computes the Content-Digest of the request body, the
+// replayable bodies are hashed beforehand and the others are sent
+// chunked with the digest in the trailer
+type contentDigester []string
+
+func (d contentDigester) hashes() []hash.Hash {
+	hashes := make([]hash.Hash, len(d))
+	for i, alg := range d {
+		hashes[i] = contentDigestHashes[alg]()
+	}
+	return hashes
+}
+
+func (d contentDigester) Sign(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody || req.Header.Get(HeaderContentDigest) != "" {
+		return nil
+	}
+	for _, alg := range d {
+		if _, ok := contentDigestHashes[alg]; !ok {
+			return fmt.Errorf("req: unsupported digest algorithm %s", alg)
+		}
+	}
+
+	hashes := d.hashes()
+	if req.GetBody == nil {
+		if req.Trailer == nil {
+			req.Trailer = make(http.Header)
+		}
+		req.Trailer[HeaderContentDigest] = nil
+		req.ContentLength = -1
+		req.Body = &trailerDigestBody{ReadCloser: req.Body, req: req, algorithms: d, hashes: hashes}
+		return nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	w := make([]io.Writer, len(hashes))
+	for i, h := range hashes {
+		w[i] = h
+	}
+	if _, err := io.Copy(io.MultiWriter(w...), body); err != nil {
+		return err
+	}
+	req.Header.Set(HeaderContentDigest, formatDigests(d, hashes))
+	return nil
+}
+
+// trailerDigestBody sets the Content-Digest trailer at the end of the body
+type trailerDigestBody struct {
+	io.ReadCloser
+	req        *http.Request
+	algorithms []string
+	hashes     []hash.Hash
+}
+
+func (b *trailerDigestBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	for _, h := range b.hashes {
+		h.Write(p[:n])
+	}
+	if err == io.EOF {
+		b.req.Trailer.Set(HeaderContentDigest, formatDigests(b.algorithms, b.hashes))
+	}
+	return n, err
+}
+
+// digestCheck the expected digest of the body
+type digestCheck struct {
+	header    string
+	algorithm string
+	expected  []byte
+	hash      hash.Hash
+}
+
+// responseDigests returns the checks of the Content-Digest, Repr-Digest
+// and Content-MD5 headers, the strongest algorithm of each header is used
+func responseDigests(resp *http.Response) []*digestCheck {
+	// the digests cover the encoded content
+	if resp.Uncompressed || resp.Body == nil || resp.Body == http.NoBody ||
+		resp.StatusCode == http.StatusNotModified || resp.Request != nil && resp.Request.Method == http.MethodHead {
+		return nil
+	}
+
+	var checks []*digestCheck
+	headers := []string{HeaderContentDigest}
+	if resp.StatusCode != http.StatusPartialContent {
+		headers = append(headers, HeaderReprDigest)
+	}
+	for _, header := range headers {
+		digests := parseDigests(strings.Join(resp.Header.Values(header), ","))
+		for _, alg := range []string{DigestSHA512, DigestSHA256} {
+			if sum, ok := digests[alg]; ok {
+				checks = append(checks, &digestCheck{header: header, algorithm: alg, expected: sum, hash: contentDigestHashes[alg]()})
+				break
+			}
+		}
+	}
+
+	if v := resp.Header.Get(HeaderContentMD5); v != "" && resp.StatusCode != http.StatusPartialContent {
+		if sum, err := base64.StdEncoding.DecodeString(v); err == nil {
+			checks = append(checks, &digestCheck{header: HeaderContentMD5, algorithm: "md5", expected: sum, hash: md5.New()})
+		}
+	}
+	return checks
+}
+
+// verifyDigestBody verifies the digests at the end of the body,
+// the mismatch is returned as a *DigestError instead of io.EOF
+type verifyDigestBody struct {
+	io.ReadCloser
+	checks []*digestCheck
+	err    error
+}
+
+func (b *verifyDigestBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	for _, c := range b.checks {
+		c.hash.Write(p[:n])
+	}
+	if err == io.EOF {
+		for _, c := range b.checks {
+			if sum := c.hash.Sum(nil); !bytes.Equal(sum, c.expected) {
+				b.err = &DigestError{Header: c.header, Algorithm: c.algorithm, Expected: c.expected, Actual: sum}
+				return n, b.err
+			}
+		}
+	}
+	return n, err
+}
+
+func newVerifyDigestMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			resp, err := next(req)
+			if err != nil {
+				return resp, err
+			}
+			if checks := responseDigests(resp); len(checks) > 0 {
+				resp.Body = &verifyDigestBody{ReadCloser: resp.Body, checks: checks}
+				// mark the response to read its body to the end
+				if resp.Request != nil {
+					req = resp.Request
+				}
+				resp.Request = req.WithContext(context.WithValue(req.Context(), verifyDigestKey{}, true))
+			}
+			return resp, nil
+		}
+	}
+}
+
+type verifyDigestKey struct{}
+
+// verifyingDigest reports whether the digests of the response body
+// are verified at the end of the body
+func verifyingDigest(resp *http.Response) bool {
+	return resp.Request != nil && resp.Request.Context().Value(verifyDigestKey{}) != nil
+}
@@ -0,0 +1,155 @@
+package req
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestContentDigest(t *testing.T) {
+	sha256Digest := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	}
+	sha512Digest := func(s string) string {
+		sum := sha512.Sum512([]byte(s))
+		return "sha-512=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/echo":
+			ioutil.ReadAll(r.Body)
+			digest := r.Header.Get(HeaderContentDigest)
+			if digest == "" {
+				digest = "trailer " + r.Trailer.Get(HeaderContentDigest)
+			}
+			fmt.Fprint(w, digest)
+		case "/content":
+			w.Header().Set(HeaderContentDigest, "unknown=:AAAA:, "+sha256Digest("hello"))
+			fmt.Fprint(w, "hello")
+		case "/repr":
+			w.Header().Set(HeaderReprDigest, sha512Digest(`"hello"`))
+			fmt.Fprint(w, `"hello"`)
+		case "/md5":
+			sum := md5.Sum([]byte("hello"))
+			w.Header().Set(HeaderContentMD5, base64.StdEncoding.EncodeToString(sum[:]))
+			fmt.Fprint(w, "hello")
+		case "/stream":
+			fmt.Fprint(w, `"hello" "world"`)
+		case "/open":
+			// the connection is kept open after the first value
+			fmt.Fprint(w, `"hello"`)
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		case "/partial":
+			w.Header().Set(HeaderReprDigest, sha256Digest("hello world"))
+			w.WriteHeader(http.StatusPartialContent)
+			fmt.Fprint(w, "hello")
+		}
+	}))
+	defer ts.Close()
+
+	Convey("Test Content Digest", t, func() {
+		r := New(SetContentDigest())
+
+		resp, err := r.Post(context.Background(), ts.URL+"/echo", strings.NewReader("foo"))
+		So(err, ShouldBeNil)
+		body, _ := resp.String()
+		So(body, ShouldEqual, sha256Digest("foo"))
+
+		resp, err = r.Post(context.Background(), ts.URL+"/echo", strings.NewReader("foo"),
+			SetRequestContentDigest(DigestSHA256, DigestSHA512))
+		So(err, ShouldBeNil)
+		body, _ = resp.String()
+		So(body, ShouldEqual, sha256Digest("foo")+", "+sha512Digest("foo"))
+
+		// the streams are sent with the digest in the trailer
+		resp, err = r.Post(context.Background(), ts.URL+"/echo", ioutil.NopCloser(strings.NewReader("foo")))
+		So(err, ShouldBeNil)
+		body, _ = resp.String()
+		So(body, ShouldEqual, "trailer "+sha256Digest("foo"))
+
+		_, err = r.Post(context.Background(), ts.URL+"/echo", strings.NewReader("foo"), SetRequestContentDigest("md5"))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test Verify Digest", t, func() {
+		r := New(SetVerifyDigest())
+
+		for _, path := range []string{"/content", "/md5", "/partial"} {
+			resp, err := r.Get(context.Background(), ts.URL+path, nil)
+			So(err, ShouldBeNil)
+			body, err := resp.String()
+			So(err, ShouldBeNil)
+			So(body, ShouldEqual, "hello")
+		}
+
+		var s string
+		resp, err := r.Get(context.Background(), ts.URL+"/repr", nil)
+		So(err, ShouldBeNil)
+		So(resp.JSON(&s), ShouldBeNil)
+		So(s, ShouldEqual, "hello")
+
+		// the first value is decoded regardless of the trailing data
+		resp, err = r.Get(context.Background(), ts.URL+"/stream", nil)
+		So(err, ShouldBeNil)
+		So(resp.JSON(&s), ShouldBeNil)
+		So(s, ShouldEqual, "hello")
+
+		// the body without digests isn't read to the end
+		start := time.Now()
+		resp, err = r.Get(context.Background(), ts.URL+"/open", nil)
+		So(err, ShouldBeNil)
+		So(resp.JSON(&s), ShouldBeNil)
+		So(s, ShouldEqual, "hello")
+		So(time.Since(start), ShouldBeLessThan, 500*time.Millisecond)
+
+		// the corrupted payloads
+		corrupt := SetRequestMiddleware(func(next Handler) Handler {
+			return func(req *http.Request) (*http.Response, error) {
+				resp, err := next(req)
+				if err == nil {
+					resp.Body.Close()
+					resp.Body = ioutil.NopCloser(strings.NewReader(`"hellO"`))
+				}
+				return resp, err
+			}
+		})
+
+		resp, err = r.Get(context.Background(), ts.URL+"/content", nil, corrupt)
+		So(err, ShouldBeNil)
+		_, err = resp.Bytes()
+		var de *DigestError
+		So(errors.As(err, &de), ShouldBeTrue)
+		So(de.Header, ShouldEqual, HeaderContentDigest)
+		So(de.Algorithm, ShouldEqual, DigestSHA256)
+
+		resp, err = r.Get(context.Background(), ts.URL+"/repr", nil, corrupt)
+		So(err, ShouldBeNil)
+		err = resp.JSON(&s)
+		So(errors.As(err, &de), ShouldBeTrue)
+		So(de.Header, ShouldEqual, HeaderReprDigest)
+
+		resp, err = r.Get(context.Background(), ts.URL+"/md5", nil, corrupt)
+		So(err, ShouldBeNil)
+		_, err = resp.Bytes()
+		So(errors.As(err, &de), ShouldBeTrue)
+		So(de.Header, ShouldEqual, HeaderContentMD5)
+	})
+}
@@ -0,0 +1,376 @@
+package req
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// shellQuote quotes s for the POSIX shell
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			strings.ContainsRune("-_./:=@%+,", r))
+	}) == -1 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// requestBody reads the body of the request without consuming it
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+
+	buf, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(buf))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(buf)), nil
+	}
+	return buf, nil
+}
+
+// curlMaxBodySize the maximum size of the body printed by ToCurl
+const curlMaxBodySize = 64 << 10
+
+// curlBody reads up to max bytes of the body without consuming it,
+// ok is false if the body is larger or can't be read again
+func curlBody(req *http.Request, max int64) (body []byte, ok bool, err error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+	if req.GetBody == nil || req.ContentLength > max {
+		return nil, false, nil
+	}
+
+	rc, err := req.GetBody()
+	if err != nil {
+		return nil, false, err
+	}
+	defer rc.Close()
+	body, err = ioutil.ReadAll(io.LimitReader(rc, max+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(body)) > max {
+		return nil, false, nil
+	}
+	return body, true, nil
+}
+
+// ToCurl returns the curl command line of the request, the replayable
+// body up to 64KB is read without consuming it, the larger or
+// non-replayable body is printed as --data-binary @-
+func ToCurl(req *http.Request) (string, error) {
+	body, ok, err := curlBody(req, curlMaxBodySize)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"curl"}
+	if req.Method != http.MethodGet || len(body) > 0 || !ok {
+		if req.Method == http.MethodHead {
+			args = append(args, "--head")
+		} else {
+			args = append(args, "-X", req.Method)
+		}
+	}
+
+	keys := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range req.Header[k] {
+			if k == HeaderAuthorization {
+				if username, password, ok := req.BasicAuth(); ok {
+					args = append(args, "-u", shellQuote(username+":"+password))
+					continue
+				}
+			}
+			args = append(args, "-H", shellQuote(k+": "+v))
+		}
+	}
+
+	if !ok {
+		args = append(args, "--data-binary", "@-")
+	} else if len(body) > 0 {
+		args = append(args, "--data-binary", shellQuote(string(body)))
+	}
+	args = append(args, shellQuote(req.URL.String()))
+	return strings.Join(args, " "), nil
+}
+
+// CurlCommand the request parsed from a curl command line
+type CurlCommand struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   string
+}
+
+// Options returns the request options setting the headers
+func (c *CurlCommand) Options() []RequestOption {
+	var opts []RequestOption
+	for k, vs := range c.Header {
+		k, vs := k, vs
+		opts = append(opts, func(o *requestOptions) {
+			o.request.Header[k] = append([]string(nil), vs...)
+		})
+	}
+	return opts
+}
+
+// Do executes the command through the requester
+func (c *CurlCommand) Do(ctx context.Context, r Requester, opts ...RequestOption) (Responser, error) {
+	var body io.Reader
+	if c.Body != "" {
+		body = strings.NewReader(c.Body)
+	}
+	return r.Do(ctx, c.URL, c.Method, body, append(c.Options(), opts...)...)
+}
+
+// splitShellWords splits the command line like the POSIX shell,
+// handling quotes, escapes and line continuations
+func splitShellWords(s string) ([]string, error) {
+	var (
+		words   []string
+		buf     strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+			if r == '\n' {
+				continue
+			}
+			buf.WriteRune(r)
+			inWord = true
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				buf.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				buf.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inWord {
+				words = append(words, buf.String())
+				buf.Reset()
+				inWord = false
+			}
+		default:
+			buf.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, errors.New("req: unterminated quote in curl command")
+	}
+	if inWord {
+		words = append(words, buf.String())
+	}
+	return words, nil
+}
+
+// curlValueOptions the short curl options taking a value
+const curlValueOptions = "XHduAeb"
+
+// splitShortOptions splits the combined short options such as -sSL
+// and the value attached to the option such as -XPOST
+func splitShortOptions(arg string) []string {
+	var parts []string
+	for i := 1; i < len(arg); i++ {
+		parts = append(parts, "-"+arg[i:i+1])
+		if strings.IndexByte(curlValueOptions, arg[i]) != -1 {
+			if i+1 < len(arg) {
+				parts = append(parts, arg[i+1:])
+			}
+			break
+		}
+	}
+	return parts
+}
+
+// ParseCurl parses the curl command line into a request
+func ParseCurl(command string) (*CurlCommand, error) {
+	words, err := splitShellWords(strings.TrimSpace(command))
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 || words[0] != "curl" {
+		return nil, errors.New("req: not a curl command")
+	}
+
+	c := &CurlCommand{Header: make(http.Header)}
+	var (
+		data   []string
+		getURL bool
+		head   bool
+	)
+
+	for i := 1; i < len(words); i++ {
+		if arg := words[i]; len(arg) > 2 && arg[0] == '-' && arg[1] != '-' {
+			parts := splitShortOptions(arg)
+			words = append(words[:i:i], append(parts, words[i+1:]...)...)
+		}
+
+		arg := words[i]
+		next := func() (string, error) {
+			if i+1 >= len(words) {
+				return "", fmt.Errorf("req: curl option %s requires a value", arg)
+			}
+			i++
+			return words[i], nil
+		}
+
+		var v string
+		switch arg {
+		case "-X", "--request":
+			if v, err = next(); err == nil {
+				c.Method = strings.ToUpper(v)
+			}
+		case "-H", "--header":
+			if v, err = next(); err == nil {
+				if j := strings.IndexByte(v, ':'); j > 0 {
+					c.Header.Add(strings.TrimSpace(v[:j]), strings.TrimSpace(v[j+1:]))
+				}
+			}
+		case "-d", "--data", "--data-ascii", "--data-raw", "--data-binary":
+			if v, err = next(); err == nil {
+				if arg != "--data-raw" && strings.HasPrefix(v, "@") {
+					return nil, fmt.Errorf("req: unsupported curl data from file %s", v)
+				}
+				if arg != "--data-binary" {
+					v = strings.NewReplacer("\r", "", "\n", "").Replace(v)
+				}
+				data = append(data, v)
+			}
+		case "--data-urlencode":
+			if v, err = next(); err == nil {
+				if j := strings.IndexByte(v, '='); j != -1 {
+					v = v[:j+1] + url.QueryEscape(v[j+1:])
+				} else {
+					v = url.QueryEscape(v)
+				}
+				data = append(data, v)
+			}
+		case "-u", "--user":
+			if v, err = next(); err == nil {
+				c.Header.Set(HeaderAuthorization, "Basic "+base64.StdEncoding.EncodeToString([]byte(v)))
+			}
+		case "-A", "--user-agent":
+			if v, err = next(); err == nil {
+				c.Header.Set(HeaderUserAgent, v)
+			}
+		case "-e", "--referer":
+			if v, err = next(); err == nil {
+				c.Header.Set(HeaderReferer, v)
+			}
+		case "-b", "--cookie":
+			if v, err = next(); err == nil {
+				c.Header.Set(HeaderCookie, v)
+			}
+		case "--url":
+			c.URL, err = next()
+		case "-G", "--get":
+			getURL = true
+		case "-I", "--head":
+			head = true
+		case "-L", "--location", "-k", "--insecure", "-s", "--silent", "-v", "--verbose",
+			"--compressed", "-i", "--include", "-S", "--show-error", "-f", "--fail":
+			// options not affecting the request
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return nil, fmt.Errorf("req: unsupported curl option %s", arg)
+			}
+			c.URL = arg
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.URL == "" {
+		return nil, errors.New("req: missing url in curl command")
+	}
+
+	body := strings.Join(data, "&")
+	switch {
+	case head:
+		c.Method = http.MethodHead
+	case getURL && len(data) > 0:
+		sep := "?"
+		if strings.Contains(c.URL, "?") {
+			sep = "&"
+		}
+		c.URL += sep + body
+		body = ""
+	}
+	if body != "" {
+		c.Body = body
+		if c.Method == "" {
+			c.Method = http.MethodPost
+		}
+		if c.Header.Get(HeaderContentType) == "" {
+			c.Header.Set(HeaderContentType, MIMEApplicationForm)
+		}
+	}
+	if c.Method == "" {
+		c.Method = http.MethodGet
+	}
+	return c, nil
+}
+
+func newCurlMiddleware(logf func(cmd string)) Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			if cmd, err := ToCurl(req); err == nil {
+				logf(cmd)
+			}
+			return next(req)
+		}
+	}
+}
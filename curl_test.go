@@ -0,0 +1,95 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCurl(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s:%s %s %s", r.Method, r.URL.RawQuery, user, pass, r.Header.Get("X-Foo"), body)
+	}))
+	defer ts.Close()
+
+	Convey("Test Curl Command", t, func() {
+		r := New()
+
+		var cmd string
+		resp, err := r.Post(context.Background(), ts.URL+"?a=1", strings.NewReader(`{"it's":"ok"}`),
+			SetHeader("X-Foo", "bar baz"),
+			SetBasicAuth("user", "p'ss"),
+			SetCurlLog(func(s string) { cmd = s }))
+		So(err, ShouldBeNil)
+		expected, err := resp.String()
+		So(err, ShouldBeNil)
+		So(cmd, ShouldEqual, `curl -X POST -u 'user:p'\''ss' -H 'X-Foo: bar baz' --data-binary '{"it'\''s":"ok"}' '`+ts.URL+`?a=1'`)
+
+		c, err := ParseCurl(cmd)
+		So(err, ShouldBeNil)
+		So(c.Method, ShouldEqual, http.MethodPost)
+		So(c.URL, ShouldEqual, ts.URL+"?a=1")
+		So(c.Body, ShouldEqual, `{"it's":"ok"}`)
+
+		resp, err = c.Do(context.Background(), r)
+		So(err, ShouldBeNil)
+		body, err := resp.String()
+		So(err, ShouldBeNil)
+		So(body, ShouldEqual, expected)
+
+		c, err = ParseCurl("curl -G \\\n  --data-urlencode 'q=a b' -d x=1 \"" + ts.URL + "\"")
+		So(err, ShouldBeNil)
+		So(c.Method, ShouldEqual, http.MethodGet)
+		So(c.URL, ShouldEqual, ts.URL+"?q=a+b&x=1")
+		So(c.Body, ShouldEqual, "")
+
+		// the combined short options and the attached values
+		c, err = ParseCurl(`curl -sSL -XPOST -H'X-Foo: bar' -ubar:baz -d'a=1' ` + ts.URL)
+		So(err, ShouldBeNil)
+		So(c.Method, ShouldEqual, http.MethodPost)
+		So(c.URL, ShouldEqual, ts.URL)
+		So(c.Header.Get("X-Foo"), ShouldEqual, "bar")
+		So(c.Header.Get(HeaderAuthorization), ShouldEqual, "Basic YmFyOmJheg==")
+		So(c.Body, ShouldEqual, "a=1")
+
+		c, err = ParseCurl("curl -sIk " + ts.URL)
+		So(err, ShouldBeNil)
+		So(c.Method, ShouldEqual, http.MethodHead)
+
+		_, err = ParseCurl("curl -sZ " + ts.URL)
+		So(err, ShouldNotBeNil)
+
+		_, err = ParseCurl("curl 'unterminated")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test Curl Command Large Body", t, func() {
+		r := New()
+
+		// the large and the non-replayable bodies aren't printed
+		var cmd string
+		large := strings.Repeat("a", curlMaxBodySize+1)
+		resp, err := r.Post(context.Background(), ts.URL, strings.NewReader(large), SetCurlLog(func(s string) { cmd = s }))
+		So(err, ShouldBeNil)
+		body, _ := resp.String()
+		So(body, ShouldEndWith, large)
+		So(cmd, ShouldEqual, "curl -X POST --data-binary @- "+ts.URL)
+
+		resp, err = r.Post(context.Background(), ts.URL, ioutil.NopCloser(strings.NewReader("foo")), SetCurlLog(func(s string) { cmd = s }))
+		So(err, ShouldBeNil)
+		body, _ = resp.String()
+		So(body, ShouldEndWith, "foo")
+		So(cmd, ShouldEqual, "curl -X POST --data-binary @- "+ts.URL)
+
+		_, err = ParseCurl(cmd)
+		So(err, ShouldNotBeNil)
+	})
+}
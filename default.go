@@ -74,6 +74,22 @@ func PutForm(ctx context.Context, urlStr string, body url.Values, opt ...Request
 	return req().PutForm(ctx, urlStr, body, opt...)
 }
 
+// PostMultipart post multipart form request
+func PostMultipart(ctx context.Context, urlStr string, fields url.Values, files []*FormFile, opt ...RequestOption) (Responser, error) {
+	return req().PostMultipart(ctx, urlStr, fields, files, opt...)
+}
+
+// PutMultipart put multipart form request
+func PutMultipart(ctx context.Context, urlStr string, fields url.Values, files []*FormFile, opt ...RequestOption) (Responser, error) {
+	return req().PutMultipart(ctx, urlStr, fields, files, opt...)
+}
+
+// Download download the file to the path, resuming the previous
+// interrupted download if possible
+func Download(ctx context.Context, urlStr, path string, opt ...RequestOption) error {
+	return req().Download(ctx, urlStr, path, opt...)
+}
+
 // Do http request
 func Do(ctx context.Context, urlStr, method string, body io.Reader, opt ...RequestOption) (Responser, error) {
 	return req().Do(ctx, urlStr, method, body, opt...)
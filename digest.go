@@ -0,0 +1,323 @@
+package req
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// digestAuth the credentials of the HTTP Digest authentication (RFC 7616)
+type digestAuth struct {
+	username string
+	password string
+}
+
+// digestChallenge the Digest challenge of the WWW-Authenticate header
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       []string
+	stale     bool
+	userhash  bool
+}
+
+// digestHashes the supported algorithms, the -sess variants share the hash
+var digestHashes = map[string]func() hash.Hash{
+	"MD5":         md5.New,
+	"SHA-256":     sha256.New,
+	"SHA-512-256": sha512.New512_256,
+}
+
+func (c *digestChallenge) hash() func() hash.Hash {
+	return digestHashes[strings.TrimSuffix(strings.ToUpper(c.algorithm), "-SESS")]
+}
+
+func (c *digestChallenge) sess() bool {
+	return strings.HasSuffix(strings.ToUpper(c.algorithm), "-SESS")
+}
+
+// parseAuthChallenges parses the challenges of the WWW-Authenticate header
+// values into the schemes and their parameters
+func parseAuthChallenges(values []string) []map[string]string {
+	var list []map[string]string
+	for _, v := range values {
+		var cur map[string]string
+		for s := strings.TrimSpace(v); s != ""; s = strings.TrimLeft(s, " \t,") {
+			i := strings.IndexAny(s, " \t,=")
+			if i == -1 {
+				i = len(s)
+			}
+			token := s[:i]
+			s = strings.TrimLeft(s[i:], " \t")
+
+			if !strings.HasPrefix(s, "=") {
+				// a token not followed by = starts a new challenge
+				cur = map[string]string{"": strings.ToLower(token)}
+				list = append(list, cur)
+				continue
+			}
+
+			s = strings.TrimLeft(s[1:], " \t")
+			var value string
+			if strings.HasPrefix(s, `"`) {
+				var b strings.Builder
+				j := 1
+				for ; j < len(s) && s[j] != '"'; j++ {
+					if s[j] == '\\' && j+1 < len(s) {
+						j++
+					}
+					b.WriteByte(s[j])
+				}
+				value = b.String()
+				if j < len(s) {
+					j++
+				}
+				s = s[j:]
+			} else {
+				j := strings.IndexAny(s, " \t,")
+				if j == -1 {
+					j = len(s)
+				}
+				value, s = s[:j], s[j:]
+			}
+			if cur != nil {
+				cur[strings.ToLower(token)] = value
+			}
+		}
+	}
+	return list
+}
+
+// parseDigestChallenge returns the first Digest challenge with a supported
+// algorithm, the challenges are listed in the server's preference order
+func parseDigestChallenge(values []string) *digestChallenge {
+	for _, p := range parseAuthChallenges(values) {
+		if p[""] != "digest" || p["nonce"] == "" {
+			continue
+		}
+
+		c := &digestChallenge{
+			realm:     p["realm"],
+			nonce:     p["nonce"],
+			opaque:    p["opaque"],
+			algorithm: p["algorithm"],
+			stale:     strings.EqualFold(p["stale"], "true"),
+			userhash:  strings.EqualFold(p["userhash"], "true"),
+		}
+		if c.algorithm == "" {
+			c.algorithm = "MD5"
+		}
+		for _, q := range strings.Split(p["qop"], ",") {
+			if q = strings.ToLower(strings.TrimSpace(q)); q != "" {
+				c.qop = append(c.qop, q)
+			}
+		}
+		if c.hash() != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// digestSession the challenge of a protection space and its nonce count
+type digestSession struct {
+	mu        sync.Mutex
+	challenge *digestChallenge
+	nc        uint32
+}
+
+// digestSessions the digest sessions of the client,
+// the nonce counts are tracked per origin and realm
+type digestSessions struct {
+	mu       sync.Mutex
+	sessions map[string]*digestSession
+	realms   map[string]string
+}
+
+func newDigestSessions() *digestSessions {
+	return &digestSessions{
+		sessions: make(map[string]*digestSession),
+		realms:   make(map[string]string),
+	}
+}
+
+func digestOrigin(req *http.Request) string {
+	return req.URL.Scheme + "://" + req.URL.Host
+}
+
+// lookup returns the session of the last realm challenged by the origin
+func (d *digestSessions) lookup(origin string) *digestSession {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	realm, ok := d.realms[origin]
+	if !ok {
+		return nil
+	}
+	return d.sessions[origin+" "+realm]
+}
+
+// update starts counting the nonce of the challenge
+func (d *digestSessions) update(origin string, c *digestChallenge) *digestSession {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := origin + " " + c.realm
+	d.realms[origin] = c.realm
+	s, ok := d.sessions[key]
+	if !ok {
+		s = &digestSession{}
+		d.sessions[key] = s
+	}
+
+	s.mu.Lock()
+	if s.challenge == nil || s.challenge.nonce != c.nonce {
+		s.nc = 0
+	}
+	s.challenge = c
+	s.mu.Unlock()
+	return s
+}
+
+// next returns the challenge and the next nonce count
+func (s *digestSession) next() (*digestChallenge, uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nc++
+	return s.challenge, s.nc
+}
+
+func digestHash(h func() hash.Hash, parts ...string) string {
+	w := h()
+	w.Write([]byte(strings.Join(parts, ":")))
+	return hex.EncodeToString(w.Sum(nil))
+}
+
+func digestQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// digestAuthorize returns a copy of the request with the Authorization
+// header answering the challenge with the nonce count
+func digestAuthorize(req *http.Request, auth *digestAuth, c *digestChallenge, nc uint32) (*http.Request, error) {
+	h := c.hash()
+
+	var qop string
+	for _, q := range c.qop {
+		if q == "auth" || q == "auth-int" && qop == "" {
+			qop = q
+		}
+	}
+
+	var cnonce string
+	if qop != "" || c.sess() {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		cnonce = hex.EncodeToString(b)
+	}
+
+	uri := req.URL.RequestURI()
+	ha1 := digestHash(h, auth.username, c.realm, auth.password)
+	if c.sess() {
+		ha1 = digestHash(h, ha1, c.nonce, cnonce)
+	}
+	ha2 := digestHash(h, req.Method, uri)
+	if qop == "auth-int" {
+		body, err := requestBody(req)
+		if err != nil {
+			return nil, err
+		}
+		ha2 = digestHash(h, req.Method, uri, digestHash(h, string(body)))
+	}
+
+	ncs := fmt.Sprintf("%08x", nc)
+	response := digestHash(h, ha1, c.nonce, ha2)
+	if qop != "" {
+		response = digestHash(h, ha1, c.nonce, ncs, cnonce, qop, ha2)
+	}
+
+	username := auth.username
+	if c.userhash {
+		username = digestHash(h, auth.username, c.realm)
+	}
+
+	params := []string{
+		"username=" + digestQuote(username),
+		"realm=" + digestQuote(c.realm),
+		"nonce=" + digestQuote(c.nonce),
+		"uri=" + digestQuote(uri),
+		"algorithm=" + c.algorithm,
+		"response=" + digestQuote(response),
+	}
+	if c.opaque != "" {
+		params = append(params, "opaque="+digestQuote(c.opaque))
+	}
+	if qop != "" {
+		params = append(params, "qop="+qop, "nc="+ncs, "cnonce="+digestQuote(cnonce))
+	}
+	if c.userhash {
+		params = append(params, "userhash=true")
+	}
+
+	areq := req.Clone(req.Context())
+	areq.Header.Set(HeaderAuthorization, "Digest "+strings.Join(params, ", "))
+	return areq, nil
+}
+
+// middleware answers the Digest challenges, the known challenge of the
+// origin is answered preemptively and a new one by replaying the request
+func (d *digestSessions) middleware(auth *digestAuth) Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			origin := digestOrigin(req)
+			s := d.lookup(origin)
+
+			var used *digestChallenge
+			areq := req
+			if s != nil {
+				var (
+					nc  uint32
+					err error
+				)
+				used, nc = s.next()
+				if areq, err = digestAuthorize(req, auth, used, nc); err != nil {
+					return nil, err
+				}
+			}
+
+			resp, err := next(areq)
+			if err != nil || resp.StatusCode != http.StatusUnauthorized || !canRewindBody(req) {
+				return resp, err
+			}
+
+			c := parseDigestChallenge(resp.Header.Values(HeaderWWWAuthenticate))
+			if c == nil || used != nil && used.nonce == c.nonce && !c.stale {
+				// the credentials are rejected
+				return resp, nil
+			}
+			drainBody(resp.Body)
+
+			req, err = rewindRequest(req)
+			if err != nil {
+				return nil, err
+			}
+			c, nc := d.update(origin, c).next()
+			areq, err = digestAuthorize(req, auth, c, nc)
+			if err != nil {
+				return nil, err
+			}
+			return next(areq)
+		}
+	}
+}
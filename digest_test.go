@@ -0,0 +1,110 @@
+package req
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDigestAuth(t *testing.T) {
+	sum := func(h hash.Hash, s string) string {
+		h.Write([]byte(s))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	var challenges int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		algorithm, qop, newHash := "MD5", "auth", md5.New
+		switch r.URL.Path {
+		case "/sha":
+			algorithm, qop, newHash = "SHA-256-sess", "auth-int", sha256.New
+		case "/legacy":
+			qop = ""
+		}
+		H := func(s string) string { return sum(newHash(), s) }
+
+		body, _ := ioutil.ReadAll(r.Body)
+		challenge := func() {
+			atomic.AddInt32(&challenges, 1)
+			v := fmt.Sprintf(`Basic realm="basic", Digest realm="api", nonce="nonce-%s", opaque="opaque", algorithm=%s`, algorithm, algorithm)
+			if qop != "" {
+				v += `, qop="` + qop + `"`
+			}
+			w.Header().Set(HeaderWWWAuthenticate, v)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+
+		list := parseAuthChallenges([]string{r.Header.Get(HeaderAuthorization)})
+		if len(list) != 1 || list[0][""] != "digest" || list[0]["nonce"] != "nonce-"+algorithm ||
+			list[0]["opaque"] != "opaque" || list[0]["uri"] != r.URL.RequestURI() {
+			challenge()
+			return
+		}
+		p := list[0]
+
+		ha1 := H("user:api:pass")
+		if strings.HasSuffix(algorithm, "-sess") {
+			ha1 = H(ha1 + ":" + p["nonce"] + ":" + p["cnonce"])
+		}
+		ha2 := H(r.Method + ":" + p["uri"])
+		if qop == "auth-int" {
+			ha2 = H(r.Method + ":" + p["uri"] + ":" + H(string(body)))
+		}
+		expected := H(ha1 + ":" + p["nonce"] + ":" + ha2)
+		if qop != "" {
+			expected = H(ha1 + ":" + p["nonce"] + ":" + p["nc"] + ":" + p["cnonce"] + ":" + qop + ":" + ha2)
+		}
+		if p["username"] != "user" || p["response"] != expected {
+			challenge()
+			return
+		}
+		fmt.Fprintf(w, "%s %s", p["nc"], body)
+	}))
+	defer ts.Close()
+
+	Convey("Test Digest Auth", t, func() {
+		r := New()
+
+		resp, err := r.Get(context.Background(), ts.URL+"/md5?a=1", nil, SetDigestAuth("user", "pass"))
+		So(err, ShouldBeNil)
+		body, _ := resp.String()
+		So(body, ShouldEqual, "00000001 ")
+		So(atomic.LoadInt32(&challenges), ShouldEqual, 1)
+
+		// the nonce of the realm is reused with the next count
+		resp, err = r.Get(context.Background(), ts.URL+"/md5", nil, SetDigestAuth("user", "pass"))
+		So(err, ShouldBeNil)
+		body, _ = resp.String()
+		So(body, ShouldEqual, "00000002 ")
+		So(atomic.LoadInt32(&challenges), ShouldEqual, 1)
+
+		// a new nonce restarts the count
+		resp, err = r.Post(context.Background(), ts.URL+"/sha", strings.NewReader("foo"), SetDigestAuth("user", "pass"))
+		So(err, ShouldBeNil)
+		body, _ = resp.String()
+		So(body, ShouldEqual, "00000001 foo")
+		So(atomic.LoadInt32(&challenges), ShouldEqual, 2)
+
+		resp, err = New().Get(context.Background(), ts.URL+"/legacy", nil, SetDigestAuth("user", "pass"))
+		So(err, ShouldBeNil)
+		So(resp.StatusCode(), ShouldEqual, http.StatusOK)
+
+		// the rejected credentials aren't replayed again
+		atomic.StoreInt32(&challenges, 0)
+		resp, err = r.Get(context.Background(), ts.URL+"/sha", nil, SetDigestAuth("user", "wrong"))
+		So(err, ShouldBeNil)
+		So(resp.StatusCode(), ShouldEqual, http.StatusUnauthorized)
+		So(atomic.LoadInt32(&challenges), ShouldEqual, 1)
+	})
+}
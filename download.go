@@ -0,0 +1,314 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// partSuffix the suffix of the file being downloaded,
+// the validator of the partial content is kept in the meta file
+const (
+	partSuffix     = ".part"
+	partMetaSuffix = ".part.meta"
+)
+
+// saveFile writes r to a temporary file next to path and renames it
+// to path on success
+func saveFile(path string, r io.Reader) (int64, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	tmp := f.Name()
+
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return n, err
+	}
+	return n, nil
+}
+
+// rangeValidator returns the strong validator for If-Range
+func rangeValidator(h http.Header) string {
+	if etag := h.Get(HeaderETag); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return h.Get(HeaderLastModified)
+}
+
+// parseContentRange parses "bytes first-last/complete" and "bytes */complete",
+// the first is -1 for an unsatisfied range and the complete is -1 if unknown
+func parseContentRange(v string) (first, last, complete int64, ok bool) {
+	if !strings.HasPrefix(v, "bytes ") {
+		return 0, 0, 0, false
+	}
+	v = strings.TrimSpace(v[len("bytes "):])
+
+	i := strings.IndexByte(v, '/')
+	if i == -1 {
+		return 0, 0, 0, false
+	}
+	complete = -1
+	if s := v[i+1:]; s != "*" {
+		if _, err := fmt.Sscanf(s, "%d", &complete); err != nil {
+			return 0, 0, 0, false
+		}
+	}
+
+	if v[:i] == "*" {
+		return -1, -1, complete, true
+	}
+	if _, err := fmt.Sscanf(v[:i], "%d-%d", &first, &last); err != nil || last < first {
+		return 0, 0, 0, false
+	}
+	return first, last, complete, true
+}
+
+func (r *request) download(ctx context.Context, urlStr, path string, resume bool, opts ...RequestOption) error {
+	part, meta := path+partSuffix, path+partMetaSuffix
+
+	var offset int64
+	var ro []RequestOption
+	ro = append(ro, SetHeader(HeaderAcceptEncoding, "identity"))
+	if resume {
+		if fi, err := os.Stat(part); err == nil && fi.Size() > 0 {
+			if b, err := ioutil.ReadFile(meta); err == nil && len(b) > 0 {
+				offset = fi.Size()
+				ro = append(ro,
+					SetHeader(HeaderRange, fmt.Sprintf("bytes=%d-", offset)),
+					SetHeader(HeaderIfRange, string(b)),
+				)
+			}
+		}
+	}
+	ro = append(ro, opts...)
+	ro = append(ro, SetRequestExpectStatus(http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable))
+
+	resp, err := r.Get(ctx, urlStr, nil, ro...)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	res := resp.Response()
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		first, _, _, ok := parseContentRange(res.Header.Get(HeaderContentRange))
+		if !ok || first != offset {
+			return fmt.Errorf("req: unexpected content range %q for offset %d", res.Header.Get(HeaderContentRange), offset)
+		}
+		flag = os.O_WRONLY | os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		_, _, complete, ok := parseContentRange(res.Header.Get(HeaderContentRange))
+		if ok && offset > 0 && complete == offset {
+			// the previous attempt was interrupted after the last byte
+			os.Remove(meta)
+			return os.Rename(part, path)
+		}
+		if !resume || offset == 0 {
+			return newStatusError(res)
+		}
+		resp.Close()
+		return r.download(ctx, urlStr, path, false, opts...)
+	}
+
+	if v := rangeValidator(res.Header); v != "" {
+		if err := ioutil.WriteFile(meta, []byte(v), 0644); err != nil {
+			return err
+		}
+	} else {
+		os.Remove(meta)
+	}
+
+	f, err := os.OpenFile(part, flag, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, res.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// keep the partial file to resume the download
+		return err
+	}
+
+	if err := os.Rename(part, path); err != nil {
+		return err
+	}
+	os.Remove(meta)
+	return nil
+}
+
+// acceptRanges reports whether the server accepts byte range requests
+func acceptRanges(h http.Header) bool {
+	for _, v := range strings.Split(h.Get(HeaderAcceptRanges), ",") {
+		if strings.EqualFold(strings.TrimSpace(v), "bytes") {
+			return true
+		}
+	}
+	return false
+}
+
+// offsetWriter writes to the file sequentially from the offset
+type offsetWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// MaxDownloadSegments the maximum number of the segments fetched
+// concurrently by DownloadParallel
+const MaxDownloadSegments = 16
+
+// DownloadParallel download the file to the path through the requester by
+// fetching the byte ranges of the segments concurrently, up to
+// MaxDownloadSegments, the default requester if r is nil
+func DownloadParallel(ctx context.Context, r Requester, urlStr, path string, segments int, opts ...RequestOption) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if r == nil {
+		r = req()
+	}
+
+	var ro []RequestOption
+	ro = append(ro, SetHeader(HeaderAcceptEncoding, "identity"))
+	ro = append(ro, opts...)
+	ro = append(ro, SetRequestExpectStatus(http.StatusOK))
+
+	head, err := r.Head(ctx, urlStr, nil, ro...)
+	if err != nil {
+		return err
+	}
+	head.Close()
+
+	header := head.Response().Header
+	size := head.Response().ContentLength
+	if segments <= 1 || size <= 0 || !acceptRanges(header) {
+		return r.Download(ctx, urlStr, path, opts...)
+	}
+	if segments > MaxDownloadSegments {
+		segments = MaxDownloadSegments
+	}
+	if int64(segments) > size {
+		segments = int(size)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		total    int64
+	)
+	validator := rangeValidator(header)
+	chunk := (size + int64(segments) - 1) / int64(segments)
+	for start := int64(0); start < size; start += chunk {
+		end := start + chunk - 1
+		if end >= size {
+			end = size - 1
+		}
+
+		wg.Add(1)
+		go func(start, end int64) {
+			defer wg.Done()
+
+			n, err := downloadSegment(ctx, r, urlStr, f, start, end, validator, opts...)
+			atomic.AddInt64(&total, n)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if total != size {
+		return fmt.Errorf("req: downloaded %d bytes, expected %d", total, size)
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func downloadSegment(ctx context.Context, r Requester, urlStr string, f *os.File, start, end int64, validator string, opts ...RequestOption) (int64, error) {
+	var ro []RequestOption
+	ro = append(ro,
+		SetHeader(HeaderAcceptEncoding, "identity"),
+		SetHeader(HeaderRange, fmt.Sprintf("bytes=%d-%d", start, end)),
+	)
+	if validator != "" {
+		ro = append(ro, SetHeader(HeaderIfRange, validator))
+	}
+	ro = append(ro, opts...)
+	ro = append(ro, SetRequestExpectStatus(http.StatusPartialContent))
+
+	resp, err := r.Get(ctx, urlStr, nil, ro...)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Close()
+
+	cr := resp.Response().Header.Get(HeaderContentRange)
+	if first, last, _, ok := parseContentRange(cr); !ok || first != start || last != end {
+		return 0, fmt.Errorf("req: unexpected content range %q for range %d-%d", cr, start, end)
+	}
+
+	n, err := io.Copy(&offsetWriter{f: f, offset: start}, io.LimitReader(resp.Response().Body, end-start+1))
+	if err != nil {
+		return n, err
+	}
+	if n != end-start+1 {
+		return n, fmt.Errorf("req: short segment %d-%d, got %d bytes", start, end, n)
+	}
+	return n, nil
+}
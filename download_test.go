@@ -0,0 +1,111 @@
+package req
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDownload(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get(HeaderRange))
+		w.Header().Set(HeaderETag, `"v1"`)
+		http.ServeContent(w, r, "data.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "req")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Convey("Test Download Request", t, func() {
+		r := New()
+		path := filepath.Join(dir, "data.txt")
+
+		ranges = nil
+		So(r.Download(context.Background(), ts.URL, path), ShouldBeNil)
+		b, err := ioutil.ReadFile(path)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, content)
+		So(ranges, ShouldResemble, []string{""})
+
+		ranges = nil
+		So(ioutil.WriteFile(path+partSuffix, []byte(content[:4000]), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(path+partMetaSuffix, []byte(`"v1"`), 0644), ShouldBeNil)
+		So(r.Download(context.Background(), ts.URL, path), ShouldBeNil)
+		b, err = ioutil.ReadFile(path)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, content)
+		So(ranges, ShouldResemble, []string{"bytes=4000-"})
+		_, err = os.Stat(path + partMetaSuffix)
+		So(os.IsNotExist(err), ShouldBeTrue)
+
+		ranges = nil
+		So(ioutil.WriteFile(path+partSuffix, []byte("stale"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(path+partMetaSuffix, []byte(`"v0"`), 0644), ShouldBeNil)
+		So(r.Download(context.Background(), ts.URL, path), ShouldBeNil)
+		b, err = ioutil.ReadFile(path)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, content)
+
+		resp, err := r.Get(context.Background(), ts.URL, nil)
+		So(err, ShouldBeNil)
+		var buf bytes.Buffer
+		n, err := resp.CopyTo(&buf)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, len(content))
+		So(buf.String(), ShouldEqual, content)
+	})
+}
+
+func TestDownloadParallel(t *testing.T) {
+	content := strings.Repeat("0123456789", 1001)
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(HeaderRange) != "" {
+			atomic.AddInt32(&count, 1)
+		}
+		w.Header().Set(HeaderETag, `"v1"`)
+		http.ServeContent(w, r, "data.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "req")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Convey("Test Parallel Download Request", t, func() {
+		r := New()
+		path := filepath.Join(dir, "data.txt")
+
+		So(DownloadParallel(context.Background(), r, ts.URL, path, 4), ShouldBeNil)
+		b, err := ioutil.ReadFile(path)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, content)
+		So(atomic.LoadInt32(&count), ShouldEqual, 4)
+
+		// the segments are bounded
+		atomic.StoreInt32(&count, 0)
+		So(DownloadParallel(context.Background(), r, ts.URL, path, 10000), ShouldBeNil)
+		b, err = ioutil.ReadFile(path)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, content)
+		So(atomic.LoadInt32(&count), ShouldEqual, MaxDownloadSegments)
+	})
+}
@@ -0,0 +1,79 @@
+package req
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxErrorBodySize the maximum size of the body kept by StatusError
+const maxErrorBodySize = 4 << 10
+
+var _ error = &StatusError{}
+
+// StatusError is returned when the response status code is not expected
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Header     http.Header
+	// Body the leading part of the response body (at most 4KB)
+	Body []byte
+}
+
+func newStatusError(resp *http.Response) *StatusError {
+	e := &StatusError{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+	}
+	if req := resp.Request; req != nil {
+		e.Method = req.Method
+		if req.URL != nil {
+			e.URL = req.URL.String()
+		}
+	}
+
+	if resp.Body != nil {
+		e.Body, _ = ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		drainBody(resp.Body)
+	}
+	return e
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("req: %s %s: unexpected status %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if len(e.Body) > 0 {
+		body := e.Body
+		if len(body) > 256 {
+			body = body[:256]
+		}
+		msg = fmt.Sprintf("%s: %q", msg, body)
+	}
+	return msg
+}
+
+// statusChecker decides whether the status code is expected,
+// without codes any status below 400 is expected
+type statusChecker struct {
+	codes []int
+}
+
+func (c *statusChecker) expected(code int) bool {
+	if len(c.codes) == 0 {
+		return code < 400
+	}
+	for _, v := range c.codes {
+		if v == code {
+			return true
+		}
+	}
+	return false
+}
+
+func checkStatus(c *statusChecker, resp *http.Response) error {
+	if c == nil || c.expected(resp.StatusCode) {
+		return nil
+	}
+	return newStatusError(resp)
+}
@@ -0,0 +1,39 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStatusError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderContentType, MIMETextHTML)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("<html>oops</html>"))
+	}))
+	defer ts.Close()
+
+	Convey("Test Status Error", t, func() {
+		r := New(SetFailOnErrorStatus())
+
+		resp, err := r.Get(context.Background(), ts.URL, nil)
+		So(resp, ShouldBeNil)
+		var se *StatusError
+		So(errors.As(err, &se), ShouldBeTrue)
+		So(se.Method, ShouldEqual, http.MethodGet)
+		So(se.URL, ShouldEqual, ts.URL)
+		So(se.StatusCode, ShouldEqual, http.StatusInternalServerError)
+		So(se.Header.Get(HeaderContentType), ShouldEqual, MIMETextHTML)
+		So(string(se.Body), ShouldEqual, "<html>oops</html>")
+
+		resp, err = r.Get(context.Background(), ts.URL, nil, SetRequestExpectStatus(http.StatusInternalServerError))
+		So(err, ShouldBeNil)
+		So(resp.StatusCode(), ShouldEqual, http.StatusInternalServerError)
+		resp.Close()
+	})
+}
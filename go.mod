@@ -1,5 +1,5 @@
 module github.com/LyricTian/req
 
-go 1.13
+go 1.16
 
 require github.com/smartystreets/goconvey v1.6.4
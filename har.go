@@ -0,0 +1,411 @@
+package req
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR the HTTP Archive 1.2 document
+type HAR struct {
+	Log *HARLog `json:"log"`
+}
+
+// HARLog the HAR log
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator *HARCreator `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+// HARCreator the HAR creator
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry the HAR entry of an exchange
+type HAREntry struct {
+	StartedDateTime string       `json:"startedDateTime"`
+	Time            float64      `json:"time"`
+	Request         *HARRequest  `json:"request"`
+	Response        *HARResponse `json:"response"`
+	Cache           struct{}     `json:"cache"`
+	Timings         *HARTimings  `json:"timings"`
+}
+
+// HARRequest the HAR request
+type HARRequest struct {
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []*HARCookie    `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	QueryString []*HARNameValue `json:"queryString"`
+	PostData    *HARPostData    `json:"postData,omitempty"`
+	HeadersSize int64           `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+}
+
+// HARResponse the HAR response
+type HARResponse struct {
+	Status      int             `json:"status"`
+	StatusText  string          `json:"statusText"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []*HARCookie    `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	Content     *HARContent     `json:"content"`
+	RedirectURL string          `json:"redirectURL"`
+	HeadersSize int64           `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+}
+
+// HARNameValue the HAR name/value pair
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARCookie the HAR cookie
+type HARCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+// HARPostData the HAR request body
+type HARPostData struct {
+	MimeType string          `json:"mimeType"`
+	Params   []*HARNameValue `json:"params"`
+	Text     string          `json:"text"`
+	Comment  string          `json:"comment,omitempty"`
+}
+
+// HARContent the HAR response body
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings the HAR timings in milliseconds, -1 if not applicable
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// harTruncated the comment of the truncated bodies
+const harTruncated = "truncated"
+
+// NewHARRecorder create a HAR recorder writing the archive to w on Flush
+func NewHARRecorder(w io.Writer) *HARRecorder {
+	return &HARRecorder{w: w}
+}
+
+// NewHARFile create a HAR recorder writing the archive file
+// on Flush or Close
+func NewHARFile(path string) *HARRecorder {
+	return &HARRecorder{path: path}
+}
+
+// HARRecorder captures the exchanges into a HAR archive, an exchange is
+// captured once its response body is read to the end or closed, the
+// credentials and the cookies are redacted
+type HARRecorder struct {
+	// MaxBodySize the maximum size of the captured bodies, the larger
+	// bodies are truncated (default 1MB)
+	MaxBodySize int
+
+	mu      sync.Mutex
+	w       io.Writer
+	path    string
+	entries []*HAREntry
+}
+
+func (h *HARRecorder) maxBodySize() int {
+	if h.MaxBodySize <= 0 {
+		return 1 << 20
+	}
+	return h.MaxBodySize
+}
+
+// HAR returns the archive of the captured exchanges
+func (h *HARRecorder) HAR() *HAR {
+	h.mu.Lock()
+	entries := make([]*HAREntry, len(h.entries))
+	copy(entries, h.entries)
+	h.mu.Unlock()
+
+	return &HAR{
+		Log: &HARLog{
+			Version: "1.2",
+			Creator: &HARCreator{Name: "github.com/LyricTian/req", Version: "1.0"},
+			Entries: entries,
+		},
+	}
+}
+
+// WriteTo writes the archive to w
+func (h *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	buf, err := json.MarshalIndent(h.HAR(), "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// Flush writes the archive to the writer or the file
+func (h *HARRecorder) Flush() error {
+	if h.path != "" {
+		var buf bytes.Buffer
+		if _, err := h.WriteTo(&buf); err != nil {
+			return err
+		}
+		_, err := saveFile(h.path, &buf)
+		return err
+	}
+	if h.w != nil {
+		_, err := h.WriteTo(h.w)
+		return err
+	}
+	return nil
+}
+
+// Close writes the archive, see Flush
+func (h *HARRecorder) Close() error {
+	return h.Flush()
+}
+
+func (h *HARRecorder) add(e *HAREntry) {
+	h.mu.Lock()
+	h.entries = append(h.entries, e)
+	h.mu.Unlock()
+}
+
+func harNameValues(m map[string][]string) []*HARNameValue {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	list := make([]*HARNameValue, 0, len(m))
+	for _, k := range keys {
+		for _, v := range m[k] {
+			list = append(list, &HARNameValue{Name: k, Value: v})
+		}
+	}
+	return list
+}
+
+// harCookies the cookies with their values redacted
+func harCookies(cookies []*http.Cookie) []*HARCookie {
+	list := make([]*HARCookie, 0, len(cookies))
+	for _, c := range cookies {
+		hc := &HARCookie{
+			Name:     c.Name,
+			Value:    redacted,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		}
+		if !c.Expires.IsZero() {
+			hc.Expires = c.Expires.Format(time.RFC3339)
+		}
+		list = append(list, hc)
+	}
+	return list
+}
+
+func harRequest(req *http.Request, body *captureBody) *HARRequest {
+	hr := &HARRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: req.Proto,
+		Cookies:     harCookies(req.Cookies()),
+		Headers:     harNameValues(redactHeader(req.Header, defaultRedactHeaders)),
+		QueryString: harNameValues(req.URL.Query()),
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+	if body == nil {
+		return hr
+	}
+
+	hr.BodySize = int64(body.buf.Len())
+	if req.ContentLength > 0 {
+		hr.BodySize = req.ContentLength
+	}
+	ct := req.Header.Get(HeaderContentType)
+	hr.PostData = &HARPostData{
+		MimeType: ct,
+		Params:   []*HARNameValue{},
+		Text:     body.buf.String(),
+	}
+	if body.truncated {
+		hr.PostData.Comment = harTruncated
+	} else if mediaType(ct) == MIMEApplicationForm {
+		if values, err := url.ParseQuery(body.buf.String()); err == nil {
+			hr.PostData.Params = harNameValues(values)
+		}
+	}
+	return hr
+}
+
+func harResponse(resp *http.Response, body []byte, size int64) *HARResponse {
+	hr := &HARResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Cookies:     harCookies(resp.Cookies()),
+		Headers:     harNameValues(redactHeader(resp.Header, defaultRedactHeaders)),
+		RedirectURL: resp.Header.Get(HeaderLocation),
+		HeadersSize: -1,
+		BodySize:    size,
+		Content: &HARContent{
+			Size:     size,
+			MimeType: resp.Header.Get(HeaderContentType),
+		},
+	}
+	if size > int64(len(body)) {
+		hr.Content.Comment = harTruncated
+	}
+
+	if len(body) > 0 {
+		mt, _, _ := mime.ParseMediaType(hr.Content.MimeType)
+		if utf8.Valid(body) && mt != MIMEOctetStream {
+			hr.Content.Text = string(body)
+		} else {
+			hr.Content.Text = base64.StdEncoding.EncodeToString(body)
+			hr.Content.Encoding = "base64"
+		}
+	}
+	return hr
+}
+
+func millis(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
+
+func harTimings(tm Timings) *HARTimings {
+	ht := &HARTimings{
+		Blocked: -1,
+		DNS:     -1,
+		Connect: -1,
+		SSL:     -1,
+		Receive: millis(tm.BodyTransfer),
+	}
+
+	wait := tm.FirstByte
+	if tm.DNS > 0 {
+		ht.DNS = millis(tm.DNS)
+		wait -= tm.DNS
+	}
+	if !tm.ConnReused && tm.Connect > 0 {
+		// the HAR connect time includes the SSL handshake
+		ht.Connect = millis(tm.Connect + tm.TLSHandshake)
+		wait -= tm.Connect + tm.TLSHandshake
+		if tm.TLSHandshake > 0 {
+			ht.SSL = millis(tm.TLSHandshake)
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	ht.Wait = millis(wait)
+	return ht
+}
+
+func newHARMiddleware(h *HARRecorder) Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			t := newTracer()
+
+			var reqBody *captureBody
+			if req.Body != nil && req.Body != http.NoBody {
+				reqBody = &captureBody{ReadCloser: req.Body, limit: h.maxBodySize()}
+			}
+			nreq := withTracer(req, t)
+			if reqBody != nil {
+				nreq.Body = reqBody
+			}
+
+			resp, err := next(nreq)
+			if err != nil {
+				return resp, err
+			}
+
+			resp.Body = &harBody{
+				ReadCloser: resp.Body,
+				limit:      h.maxBodySize(),
+				done: func(body []byte, size int64) {
+					t.done()
+					tm := t.timings()
+					h.add(&HAREntry{
+						StartedDateTime: start.Format(time.RFC3339Nano),
+						Time:            millis(time.Since(start)),
+						Request:         harRequest(req, reqBody),
+						Response:        harResponse(resp, body, size),
+						Timings:         harTimings(tm),
+					})
+				},
+			}
+			return resp, nil
+		}
+	}
+}
+
+// harBody captures up to limit bytes of the response body and completes
+// the entry at the end of the body or when it's closed
+type harBody struct {
+	io.ReadCloser
+	buf   bytes.Buffer
+	limit int
+	size  int64
+	once  sync.Once
+	done  func(body []byte, size int64)
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if rest := b.limit - b.buf.Len(); rest > 0 {
+		if rest > n {
+			rest = n
+		}
+		b.buf.Write(p[:rest])
+	}
+	if err == io.EOF {
+		b.once.Do(func() { b.done(b.buf.Bytes(), b.size) })
+	}
+	return n, err
+}
+
+func (b *harBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.buf.Bytes(), b.size) })
+	return err
+}
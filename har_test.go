@@ -0,0 +1,118 @@
+package req
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHAR(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "1"})
+		w.Header().Set(HeaderContentType, MIMETextPlainCharsetUTF8)
+		fmt.Fprintf(w, "hello %s", r.Form.Get("name"))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "req")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "traffic.har")
+
+	Convey("Test HAR Recorder", t, func() {
+		h := NewHARFile(path)
+		r := New(SetHAR(h))
+
+		resp, err := r.PostForm(context.Background(), ts.URL+"/?q=1", url.Values{"name": {"foo"}})
+		So(err, ShouldBeNil)
+		body, err := resp.String()
+		So(err, ShouldBeNil)
+		So(body, ShouldEqual, "hello foo")
+
+		// the file is written on Flush or Close
+		_, err = os.Stat(path)
+		So(os.IsNotExist(err), ShouldBeTrue)
+		So(h.Close(), ShouldBeNil)
+
+		buf, err := ioutil.ReadFile(path)
+		So(err, ShouldBeNil)
+		var har HAR
+		So(json.Unmarshal(buf, &har), ShouldBeNil)
+		So(har.Log.Version, ShouldEqual, "1.2")
+		So(len(har.Log.Entries), ShouldEqual, 1)
+
+		e := har.Log.Entries[0]
+		So(e.Request.Method, ShouldEqual, http.MethodPost)
+		So(e.Request.QueryString, ShouldResemble, []*HARNameValue{{Name: "q", Value: "1"}})
+		So(e.Request.PostData.Text, ShouldEqual, "name=foo")
+		So(e.Request.PostData.Params, ShouldResemble, []*HARNameValue{{Name: "name", Value: "foo"}})
+		So(e.Response.Status, ShouldEqual, 200)
+		So(e.Response.Content.Text, ShouldEqual, "hello foo")
+		So(e.Response.Cookies[0].Name, ShouldEqual, "sid")
+		So(e.Timings.Wait, ShouldBeGreaterThanOrEqualTo, 0)
+	})
+
+	Convey("Test HAR Recorder Body Size", t, func() {
+		h := NewHARRecorder(ioutil.Discard)
+		h.MaxBodySize = 4
+		r := New(SetHAR(h))
+
+		resp, err := r.PostForm(context.Background(), ts.URL, url.Values{"name": {"foo"}})
+		So(err, ShouldBeNil)
+		_, err = resp.String()
+		So(err, ShouldBeNil)
+
+		e := h.HAR().Log.Entries[0]
+		So(e.Request.PostData.Text, ShouldEqual, "name")
+		So(e.Request.PostData.Comment, ShouldEqual, "truncated")
+		So(e.Request.BodySize, ShouldEqual, 8)
+		So(e.Response.Content.Text, ShouldEqual, "hell")
+		So(e.Response.Content.Size, ShouldEqual, 9)
+		So(e.Response.Content.Comment, ShouldEqual, "truncated")
+	})
+	Convey("Test HAR Recorder Attempts", t, func() {
+		var hits int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "secret-cookie"})
+			if atomic.AddInt32(&hits, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, "ok")
+		}))
+		defer ts.Close()
+
+		h := NewHARRecorder(ioutil.Discard)
+		r := New(SetHAR(h), SetRetry(&Retry{Count: 1, WaitMin: time.Millisecond, WaitMax: time.Millisecond}))
+
+		resp, err := r.Get(context.Background(), ts.URL, nil, SetBasicAuth("user", "secret-auth"))
+		So(err, ShouldBeNil)
+		_, err = resp.String()
+		So(err, ShouldBeNil)
+
+		// the retried attempt is recorded too
+		entries := h.HAR().Log.Entries
+		So(len(entries), ShouldEqual, 2)
+		So(entries[0].Response.Status, ShouldEqual, http.StatusServiceUnavailable)
+		So(entries[1].Response.Status, ShouldEqual, http.StatusOK)
+
+		buf, err := json.Marshal(h.HAR())
+		So(err, ShouldBeNil)
+		So(string(buf), ShouldNotContainSubstring, "secret")
+		So(string(buf), ShouldContainSubstring, redacted)
+	})
+}
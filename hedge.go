@@ -0,0 +1,184 @@
+package req
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// hedgeSamples the number of the latencies kept for the percentile
+const hedgeSamples = 100
+
+// NewHedge create the hedging policy sending a hedged request
+// if no response arrives within delay
+func NewHedge(delay time.Duration) *Hedge {
+	return &Hedge{Delay: delay, Max: 1}
+}
+
+// NewPercentileHedge create the hedging policy sending a hedged request
+// if no response arrives within the percentile p (such as 0.95) of the
+// observed latencies, delay is used until enough latencies are observed
+func NewPercentileHedge(p float64, delay time.Duration) *Hedge {
+	return &Hedge{Delay: delay, Percentile: p, Max: 1}
+}
+
+// Hedge the hedging policy of the idempotent requests without body,
+// the first response wins and the other requests are canceled,
+// the policy observes the latencies and can be shared by the requests
+type Hedge struct {
+	// Delay the wait before every hedged request
+	Delay time.Duration
+	// Percentile the percentile of the observed latencies used as the
+	// delay, Delay is used if zero
+	Percentile float64
+	// Max the maximum number of hedged requests, 1 if not positive
+	Max int
+
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (hg *Hedge) max() int {
+	if hg.Max < 1 {
+		return 1
+	}
+	return hg.Max
+}
+
+// delay returns the wait before the next hedged request
+func (hg *Hedge) delay() time.Duration {
+	if hg.Percentile <= 0 {
+		return hg.Delay
+	}
+
+	hg.mu.Lock()
+	samples := make([]time.Duration, len(hg.samples))
+	copy(samples, hg.samples)
+	hg.mu.Unlock()
+
+	if len(samples) < hedgeSamples/10 {
+		return hg.Delay
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	i := int(hg.Percentile*float64(len(samples))+0.5) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(samples) {
+		i = len(samples) - 1
+	}
+	return samples[i]
+}
+
+func (hg *Hedge) observe(d time.Duration) {
+	hg.mu.Lock()
+	defer hg.mu.Unlock()
+
+	if len(hg.samples) < hedgeSamples {
+		hg.samples = append(hg.samples, d)
+		return
+	}
+	hg.samples[hg.next] = d
+	hg.next = (hg.next + 1) % hedgeSamples
+}
+
+func hedgeable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return req.Body == nil || req.Body == http.NoBody
+	}
+	return false
+}
+
+type hedgeResult struct {
+	resp *http.Response
+	err  error
+	// i the index of the request
+	i int
+}
+
+func (hg *Hedge) middleware(next Handler) Handler {
+	return func(req *http.Request) (*http.Response, error) {
+		if !hedgeable(req) {
+			return next(req)
+		}
+
+		results := make(chan *hedgeResult, hg.max()+1)
+		var cancels []context.CancelFunc
+		send := func() {
+			ctx, cancel := context.WithCancel(req.Context())
+			i := len(cancels)
+			cancels = append(cancels, cancel)
+			start := time.Now()
+			go func() {
+				resp, err := next(req.Clone(ctx))
+				if err == nil {
+					hg.observe(time.Since(start))
+				}
+				results <- &hedgeResult{resp: resp, err: err, i: i}
+			}()
+		}
+
+		// stop cancels the requests except the winner
+		// and releases the responses of the pending ones
+		stop := func(winner, pending int) {
+			for i, cancel := range cancels {
+				if i != winner {
+					cancel()
+				}
+			}
+			go func() {
+				for ; pending > 0; pending-- {
+					if res := <-results; res.resp != nil {
+						drainBody(res.resp.Body)
+					}
+				}
+			}()
+		}
+
+		send()
+		timer := time.NewTimer(hg.delay())
+		defer timer.Stop()
+
+		pending := 1
+		for {
+			select {
+			case res := <-results:
+				pending--
+				if res.err == nil {
+					stop(res.i, pending)
+					res.resp.Body = &cancelBody{ReadCloser: res.resp.Body, cancel: cancels[res.i]}
+					return res.resp, nil
+				}
+				if pending == 0 {
+					stop(-1, 0)
+					return nil, res.err
+				}
+			case <-timer.C:
+				if len(cancels) <= hg.max() {
+					pending++
+					send()
+					timer.Reset(hg.delay())
+				}
+			case <-req.Context().Done():
+				stop(-1, pending)
+				return nil, req.Context().Err()
+			}
+		}
+	}
+}
+
+// cancelBody cancels the context of the request when the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
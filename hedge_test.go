@@ -0,0 +1,71 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHedge(t *testing.T) {
+	var (
+		hits     int32
+		canceled = make(chan struct{}, 1)
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		if n == 1 {
+			// the first request is slow
+			select {
+			case <-r.Context().Done():
+				canceled <- struct{}{}
+			case <-time.After(300 * time.Millisecond):
+			}
+			return
+		}
+		fmt.Fprint(w, n)
+	}))
+	defer ts.Close()
+
+	Convey("Test Hedge", t, func() {
+		r := New()
+
+		start := time.Now()
+		resp, err := r.Get(context.Background(), ts.URL, nil, SetHedge(NewHedge(20*time.Millisecond)))
+		So(err, ShouldBeNil)
+		body, _ := resp.String()
+		So(body, ShouldEqual, "2")
+		So(time.Since(start), ShouldBeLessThan, 200*time.Millisecond)
+
+		// the loser is canceled
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Error("the slow request isn't canceled")
+		}
+
+		// the requests with body aren't hedged
+		atomic.StoreInt32(&hits, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err = r.Post(ctx, ts.URL, strings.NewReader("foo"), SetHedge(NewHedge(20*time.Millisecond)))
+		So(err, ShouldNotBeNil)
+		So(atomic.LoadInt32(&hits), ShouldEqual, 1)
+	})
+
+	Convey("Test Hedge Percentile", t, func() {
+		h := NewPercentileHedge(0.9, time.Second)
+		So(h.delay(), ShouldEqual, time.Second)
+
+		for i := 1; i <= 20; i++ {
+			h.observe(time.Duration(i) * time.Millisecond)
+		}
+		So(h.delay(), ShouldEqual, 18*time.Millisecond)
+	})
+}
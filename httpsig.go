@@ -0,0 +1,625 @@
+package req
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message signature headers (RFC 9421)
+const (
+	HeaderSignature      = "Signature"
+	HeaderSignatureInput = "Signature-Input"
+)
+
+// Message signature algorithms (RFC 9421 3.3)
+const (
+	SignatureHMACSHA256      = "hmac-sha256"
+	SignatureEd25519         = "ed25519"
+	SignatureECDSAP256SHA256 = "ecdsa-p256-sha256"
+	SignatureRSAPSSSHA512    = "rsa-pss-sha512"
+)
+
+// ErrInvalidSignature is returned when the message signature can't be verified
+var ErrInvalidSignature = errors.New("req: invalid message signature")
+
+// NewSignatureKey create the key of the message signatures, the key is
+// a []byte HMAC secret or an Ed25519, ECDSA P-256 or RSA private key,
+// the public keys can only verify the signatures
+func NewSignatureKey(key interface{}) (*SignatureKey, error) {
+	var alg string
+	switch k := key.(type) {
+	case []byte:
+		alg = SignatureHMACSHA256
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		alg = SignatureEd25519
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("req: unsupported ECDSA curve")
+		}
+		alg = SignatureECDSAP256SHA256
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("req: unsupported ECDSA curve")
+		}
+		alg = SignatureECDSAP256SHA256
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		alg = SignatureRSAPSSSHA512
+	default:
+		return nil, fmt.Errorf("req: unsupported signature key %T", key)
+	}
+	return &SignatureKey{alg: alg, key: key}, nil
+}
+
+// SignatureKey the key of the message signatures
+type SignatureKey struct {
+	alg string
+	key interface{}
+}
+
+// Algorithm returns the name of the signature algorithm
+func (k *SignatureKey) Algorithm() string {
+	return k.alg
+}
+
+// Sign signs the signature base
+func (k *SignatureKey) Sign(base []byte) ([]byte, error) {
+	switch key := k.key.(type) {
+	case []byte:
+		h := hmac.New(sha256.New, key)
+		h.Write(base)
+		return h.Sum(nil), nil
+	case ed25519.PrivateKey:
+		return ed25519.Sign(key, base), nil
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(base)
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// the signature is the concatenation of r and s
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	case *rsa.PrivateKey:
+		digest := sha512.Sum512(base)
+		return rsa.SignPSS(rand.Reader, key, crypto.SHA512, digest[:], &rsa.PSSOptions{SaltLength: 64})
+	}
+	return nil, errors.New("req: the public key can't sign")
+}
+
+// Verify verifies the signature of the signature base
+func (k *SignatureKey) Verify(base, sig []byte) error {
+	ok := false
+	switch key := k.key.(type) {
+	case []byte:
+		h := hmac.New(sha256.New, key)
+		h.Write(base)
+		ok = hmac.Equal(h.Sum(nil), sig)
+	case ed25519.PrivateKey:
+		ok = ed25519.Verify(key.Public().(ed25519.PublicKey), base, sig)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, base, sig)
+	case *ecdsa.PrivateKey:
+		ok = verifyECDSA(&key.PublicKey, base, sig)
+	case *ecdsa.PublicKey:
+		ok = verifyECDSA(key, base, sig)
+	case *rsa.PrivateKey:
+		ok = verifyRSAPSS(&key.PublicKey, base, sig)
+	case *rsa.PublicKey:
+		ok = verifyRSAPSS(key, base, sig)
+	}
+	if !ok {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func verifyECDSA(key *ecdsa.PublicKey, base, sig []byte) bool {
+	if len(sig) != 64 {
+		return false
+	}
+	digest := sha256.Sum256(base)
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	return ecdsa.Verify(key, digest[:], r, s)
+}
+
+func verifyRSAPSS(key *rsa.PublicKey, base, sig []byte) bool {
+	digest := sha512.Sum512(base)
+	return rsa.VerifyPSS(key, crypto.SHA512, digest[:], sig, &rsa.PSSOptions{SaltLength: 64}) == nil
+}
+
+// sigComponent the covered component, req marks the request components
+// of the response signatures
+type sigComponent struct {
+	name string
+	req  bool
+}
+
+func parseSigComponent(s string) sigComponent {
+	name := strings.ToLower(strings.TrimSpace(s))
+	c := sigComponent{name: name}
+	if strings.HasSuffix(name, ";req") {
+		c = sigComponent{name: strings.TrimSuffix(name, ";req"), req: true}
+	}
+	return c
+}
+
+func (c sigComponent) String() string {
+	s := strconv.Quote(c.name)
+	if c.req {
+		s += ";req"
+	}
+	return s
+}
+
+// sigMessage the request or the response of the message signature
+type sigMessage struct {
+	req  *http.Request
+	resp *http.Response
+}
+
+func (m *sigMessage) header() http.Header {
+	if m.resp != nil {
+		return m.resp.Header
+	}
+	return m.req.Header
+}
+
+// value returns the value of the component, ok is false if it's missing
+func (m *sigMessage) value(c sigComponent) (string, bool) {
+	if c.name == "@status" {
+		if m.resp == nil || c.req {
+			return "", false
+		}
+		return strconv.Itoa(m.resp.StatusCode), true
+	}
+
+	req := m.req
+	if strings.HasPrefix(c.name, "@") {
+		if req == nil {
+			return "", false
+		}
+		switch c.name {
+		case "@method":
+			return req.Method, true
+		case "@target-uri":
+			return sigScheme(req) + "://" + sigAuthority(req) + req.URL.RequestURI(), true
+		case "@authority":
+			return sigAuthority(req), true
+		case "@scheme":
+			return sigScheme(req), true
+		case "@request-target":
+			return req.URL.RequestURI(), true
+		case "@path":
+			if p := req.URL.EscapedPath(); p != "" {
+				return p, true
+			}
+			return "/", true
+		case "@query":
+			return "?" + req.URL.RawQuery, true
+		}
+		return "", false
+	}
+
+	header := m.header()
+	if c.req {
+		if req == nil {
+			return "", false
+		}
+		header = req.Header
+	}
+	vs := header.Values(c.name)
+	if vs == nil {
+		return "", false
+	}
+	list := make([]string, len(vs))
+	for i, v := range vs {
+		list[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(list, ", "), true
+}
+
+func sigScheme(req *http.Request) string {
+	if req.URL.Scheme != "" {
+		return strings.ToLower(req.URL.Scheme)
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func sigAuthority(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	host = strings.ToLower(host)
+	scheme := sigScheme(req)
+	if scheme == "http" && strings.HasSuffix(host, ":80") || scheme == "https" && strings.HasSuffix(host, ":443") {
+		host = host[:strings.LastIndexByte(host, ':')]
+	}
+	return host
+}
+
+// signatureBase builds the signature base of the components,
+// params is the serialized @signature-params value
+func (m *sigMessage) signatureBase(components []sigComponent, params string) ([]byte, error) {
+	var b strings.Builder
+	for _, c := range components {
+		v, ok := m.value(c)
+		if !ok {
+			return nil, fmt.Errorf("req: missing signature component %s", c)
+		}
+		b.WriteString(c.String() + ": " + v + "\n")
+	}
+	b.WriteString(`"@signature-params": ` + params)
+	return []byte(b.String()), nil
+}
+
+// defaultSigComponents the components signed by default, the missing
+// headers are skipped
+var defaultSigComponents = []string{"@method", "@target-uri", "@authority", "content-type", "content-digest"}
+
+var _ Signer = &MessageSigner{}
+
+// NewMessageSigner create the RFC 9421 message signer, the components
+// are the derived components such as @method, @target-uri and @authority
+// and the header names such as content-digest
+func NewMessageSigner(keyID string, key *SignatureKey, components ...string) *MessageSigner {
+	return &MessageSigner{
+		Label:      "sig1",
+		KeyID:      keyID,
+		Key:        key,
+		Components: components,
+	}
+}
+
+// MessageSigner the RFC 9421 message signer writing the Signature-Input
+// and Signature headers
+type MessageSigner struct {
+	Label string
+	KeyID string
+	Key   *SignatureKey
+	// Components the covered components, the default ones if empty
+	Components []string
+	// Expires the validity of the signature, no expiration if zero
+	Expires time.Duration
+	// Tag the application specific tag parameter
+	Tag string
+
+	now func() time.Time
+}
+
+// Sign adds the signature to the Signature-Input and Signature headers
+func (s *MessageSigner) Sign(req *http.Request) error {
+	m := &sigMessage{req: req}
+
+	var components []sigComponent
+	if len(s.Components) == 0 {
+		for _, name := range defaultSigComponents {
+			c := parseSigComponent(name)
+			if _, ok := m.value(c); ok {
+				components = append(components, c)
+			}
+		}
+	} else {
+		for _, name := range s.Components {
+			components = append(components, parseSigComponent(name))
+		}
+	}
+
+	created := time.Now()
+	if s.now != nil {
+		created = s.now()
+	}
+	list := make([]string, len(components))
+	for i, c := range components {
+		list[i] = c.String()
+	}
+	params := "(" + strings.Join(list, " ") + ");created=" + strconv.FormatInt(created.Unix(), 10)
+	if s.Expires > 0 {
+		params += ";expires=" + strconv.FormatInt(created.Add(s.Expires).Unix(), 10)
+	}
+	if s.KeyID != "" {
+		params += ";keyid=" + strconv.Quote(s.KeyID)
+	}
+	if s.Tag != "" {
+		params += ";tag=" + strconv.Quote(s.Tag)
+	}
+
+	base, err := m.signatureBase(components, params)
+	if err != nil {
+		return err
+	}
+	sig, err := s.Key.Sign(base)
+	if err != nil {
+		return err
+	}
+
+	label := s.Label
+	if label == "" {
+		label = "sig1"
+	}
+	req.Header.Add(HeaderSignatureInput, label+"="+params)
+	req.Header.Add(HeaderSignature, label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+// sigInput the parsed signature of the Signature-Input header
+type sigInput struct {
+	components []sigComponent
+	params     string
+	created    int64
+	expires    int64
+	keyID      string
+}
+
+// parseSigInputs parses the dictionary of the Signature-Input header
+func parseSigInputs(values []string) (map[string]*sigInput, error) {
+	inputs := make(map[string]*sigInput)
+	for _, v := range values {
+		for s := strings.TrimSpace(v); s != ""; s = strings.TrimLeft(s, " \t,") {
+			i := strings.IndexByte(s, '=')
+			if i <= 0 || i+1 >= len(s) || s[i+1] != '(' {
+				return nil, errors.New("req: malformed Signature-Input")
+			}
+			label := strings.TrimSpace(s[:i])
+			s = s[i+1:]
+
+			in := &sigInput{}
+			j := 1
+			for {
+				for j < len(s) && s[j] == ' ' {
+					j++
+				}
+				if j >= len(s) {
+					return nil, errors.New("req: malformed Signature-Input")
+				}
+				if s[j] == ')' {
+					j++
+					break
+				}
+				name, n, err := unquoteSig(s[j:])
+				if err != nil {
+					return nil, err
+				}
+				j += n
+				c := sigComponent{name: name}
+				if strings.HasPrefix(s[j:], ";req") {
+					c.req = true
+					j += len(";req")
+				}
+				in.components = append(in.components, c)
+			}
+
+			for j < len(s) && s[j] == ';' {
+				k := j + 1
+				for k < len(s) && s[k] != '=' && s[k] != ';' && s[k] != ',' {
+					k++
+				}
+				key := s[j+1 : k]
+				var value string
+				if k < len(s) && s[k] == '=' {
+					k++
+					if k < len(s) && s[k] == '"' {
+						v, n, err := unquoteSig(s[k:])
+						if err != nil {
+							return nil, err
+						}
+						value = v
+						k += n
+					} else {
+						e := k
+						for e < len(s) && s[e] != ';' && s[e] != ',' {
+							e++
+						}
+						value = s[k:e]
+						k = e
+					}
+				}
+				switch key {
+				case "created":
+					in.created, _ = strconv.ParseInt(value, 10, 64)
+				case "expires":
+					in.expires, _ = strconv.ParseInt(value, 10, 64)
+				case "keyid":
+					in.keyID = value
+				}
+				j = k
+			}
+
+			in.params = s[:j]
+			inputs[label] = in
+			s = s[j:]
+		}
+	}
+	return inputs, nil
+}
+
+// unquoteSig unquotes the leading string, n is the length of the quoted string
+func unquoteSig(s string) (string, int, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", 0, errors.New("req: malformed Signature-Input")
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i < len(s) {
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, errors.New("req: malformed Signature-Input")
+}
+
+// parseSignatures parses the dictionary of the Signature header
+func parseSignatures(values []string) map[string][]byte {
+	sigs := make(map[string][]byte)
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			i := strings.IndexByte(item, '=')
+			if i <= 0 {
+				continue
+			}
+			value := strings.TrimSpace(item[i+1:])
+			if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+				continue
+			}
+			if sig, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1]); err == nil {
+				sigs[strings.TrimSpace(item[:i])] = sig
+			}
+		}
+	}
+	return sigs
+}
+
+// MessageVerifier verifies the RFC 9421 message signatures
+type MessageVerifier struct {
+	// Keys returns the key of the keyid parameter
+	Keys func(keyID string) (*SignatureKey, error)
+	// Label the label of the verified signature, any signature if empty
+	Label string
+	// Required the components the signature must cover
+	Required []string
+	// MaxAge the maximum age of the created parameter, unchecked if zero
+	MaxAge time.Duration
+
+	now func() time.Time
+}
+
+// VerifyRequest verifies the signature of the request
+func (v *MessageVerifier) VerifyRequest(req *http.Request) error {
+	return v.verify(&sigMessage{req: req})
+}
+
+// VerifyResponse verifies the signature of the response, the request
+// components are taken from the request of the response
+func (v *MessageVerifier) VerifyResponse(resp *http.Response) error {
+	return v.verify(&sigMessage{req: resp.Request, resp: resp})
+}
+
+func (v *MessageVerifier) verify(m *sigMessage) error {
+	header := m.header()
+	inputs, err := parseSigInputs(header.Values(HeaderSignatureInput))
+	if err != nil {
+		return invalidSignature(err)
+	}
+	sigs := parseSignatures(header.Values(HeaderSignature))
+	if len(inputs) == 0 {
+		return fmt.Errorf("%w: no signature", ErrInvalidSignature)
+	}
+
+	err = fmt.Errorf("%w: no signature labeled %s", ErrInvalidSignature, v.Label)
+	for label, in := range inputs {
+		if v.Label != "" && label != v.Label {
+			continue
+		}
+		if err = v.verifyInput(m, in, sigs[label]); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (v *MessageVerifier) verifyInput(m *sigMessage, in *sigInput, sig []byte) error {
+	if sig == nil {
+		return fmt.Errorf("%w: missing Signature", ErrInvalidSignature)
+	}
+
+	covered := make(map[sigComponent]bool)
+	for _, c := range in.components {
+		covered[c] = true
+	}
+	for _, name := range v.Required {
+		if c := parseSigComponent(name); !covered[c] {
+			return fmt.Errorf("%w: component %s not covered", ErrInvalidSignature, c)
+		}
+	}
+
+	now := time.Now()
+	if v.now != nil {
+		now = v.now()
+	}
+	if in.expires > 0 && now.Unix() > in.expires {
+		return fmt.Errorf("%w: expired", ErrInvalidSignature)
+	}
+	if v.MaxAge > 0 && now.Sub(time.Unix(in.created, 0)) > v.MaxAge {
+		return fmt.Errorf("%w: too old", ErrInvalidSignature)
+	}
+
+	key, err := v.Keys(in.keyID)
+	if err != nil {
+		return invalidSignature(err)
+	}
+	base, err := m.signatureBase(in.components, in.params)
+	if err != nil {
+		return invalidSignature(err)
+	}
+	return key.Verify(base, sig)
+}
+
+// invalidSignature wraps the verification failure with ErrInvalidSignature
+func invalidSignature(err error) error {
+	if errors.Is(err, ErrInvalidSignature) {
+		return err
+	}
+	return &signatureError{err: err}
+}
+
+// signatureError the verification failure, it matches ErrInvalidSignature
+// and unwraps to the cause
+type signatureError struct {
+	err error
+}
+
+func (e *signatureError) Error() string {
+	return ErrInvalidSignature.Error() + ": " + strings.TrimPrefix(e.err.Error(), "req: ")
+}
+
+func (e *signatureError) Is(target error) bool {
+	return target == ErrInvalidSignature
+}
+
+func (e *signatureError) Unwrap() error {
+	return e.err
+}
+
+func newVerifierMiddleware(v *MessageVerifier) Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			resp, err := next(req)
+			if err != nil {
+				return resp, err
+			}
+			if err := v.VerifyResponse(resp); err != nil {
+				drainBody(resp.Body)
+				return nil, err
+			}
+			return resp, nil
+		}
+	}
+}
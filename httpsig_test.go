@@ -0,0 +1,164 @@
+package req
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMessageSignature(t *testing.T) {
+	Convey("Test Message Signature HMAC", t, func() {
+		// RFC 9421 B.2.5
+		secret, _ := base64.StdEncoding.DecodeString("uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ==")
+		key, err := NewSignatureKey(secret)
+		So(err, ShouldBeNil)
+		So(key.Algorithm(), ShouldEqual, SignatureHMACSHA256)
+
+		req, _ := http.NewRequest(http.MethodPost, "http://example.com/foo?param=Value&Pet=dog", strings.NewReader(`{"hello": "world"}`))
+		req.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+		req.Header.Set(HeaderContentType, MIMEApplicationJSON)
+
+		s := NewMessageSigner("test-shared-secret", key, "date", "@authority", "content-type")
+		s.Label = "sig-b25"
+		s.now = func() time.Time { return time.Unix(1618884473, 0) }
+		So(s.Sign(req), ShouldBeNil)
+		So(req.Header.Get(HeaderSignatureInput), ShouldEqual,
+			`sig-b25=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`)
+		So(req.Header.Get(HeaderSignature), ShouldEqual, "sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:")
+
+		v := &MessageVerifier{
+			Keys: func(keyID string) (*SignatureKey, error) {
+				return key, nil
+			},
+			Required: []string{"@authority"},
+		}
+		So(v.VerifyRequest(req), ShouldBeNil)
+
+		v.Required = []string{"@method"}
+		So(errors.Is(v.VerifyRequest(req), ErrInvalidSignature), ShouldBeTrue)
+
+		v.Required = nil
+		req.Header.Set(HeaderContentType, "text/plain")
+		So(errors.Is(v.VerifyRequest(req), ErrInvalidSignature), ShouldBeTrue)
+
+		// the missing covered component
+		req.Header.Del(HeaderContentType)
+		So(errors.Is(v.VerifyRequest(req), ErrInvalidSignature), ShouldBeTrue)
+
+		// the unknown key
+		errUnknownKey := errors.New("unknown key")
+		v.Keys = func(keyID string) (*SignatureKey, error) {
+			return nil, errUnknownKey
+		}
+		err = v.VerifyRequest(req)
+		So(errors.Is(err, ErrInvalidSignature), ShouldBeTrue)
+		So(errors.Is(err, errUnknownKey), ShouldBeTrue)
+
+		// the malformed header
+		req.Header.Set(HeaderSignatureInput, `sig-b25=("date";created=1`)
+		err = v.VerifyRequest(req)
+		So(errors.Is(err, ErrInvalidSignature), ShouldBeTrue)
+		So(err.Error(), ShouldEqual, "req: invalid message signature: malformed Signature-Input")
+	})
+
+	Convey("Test Message Signature Keys", t, func() {
+		_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+		ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+		for _, k := range []interface{}{edKey, ecKey, rsaKey} {
+			key, err := NewSignatureKey(k)
+			So(err, ShouldBeNil)
+
+			sig, err := key.Sign([]byte("base"))
+			So(err, ShouldBeNil)
+			So(key.Verify([]byte("base"), sig), ShouldBeNil)
+			So(key.Verify([]byte("other"), sig), ShouldNotBeNil)
+		}
+
+		pub, err := NewSignatureKey(&ecKey.PublicKey)
+		So(err, ShouldBeNil)
+		_, err = pub.Sign([]byte("base"))
+		So(err, ShouldNotBeNil)
+
+		p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		_, err = NewSignatureKey(p384)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test Message Signature Client", t, func() {
+		clientPub, clientKey, _ := ed25519.GenerateKey(rand.Reader)
+		serverKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+		clientVerify, _ := NewSignatureKey(clientPub)
+		reqVerifier := &MessageVerifier{
+			Keys: func(keyID string) (*SignatureKey, error) {
+				if keyID != "client" {
+					return nil, errors.New("unknown key")
+				}
+				return clientVerify, nil
+			},
+			Required: []string{"@method", "@target-uri", "content-type"},
+			MaxAge:   time.Minute,
+		}
+
+		serverSign, _ := NewSignatureKey(serverKey)
+		respSigner := NewMessageSigner("server", serverSign)
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := reqVerifier.VerifyRequest(r); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			// sign the response with the request method
+			resp := &http.Response{StatusCode: http.StatusOK, Header: w.Header(), Request: r}
+			w.Header().Set(HeaderContentType, "text/plain")
+			if r.URL.Path != "/unsigned" {
+				m := &sigMessage{req: r, resp: resp}
+				comps := []sigComponent{{name: "@status"}, {name: "content-type"}, {name: "@method", req: true}}
+				params := fmt.Sprintf(`("@status" "content-type" "@method";req);created=%d;keyid="server"`, time.Now().Unix())
+				base, _ := m.signatureBase(comps, params)
+				sig, _ := respSigner.Key.Sign(base)
+				w.Header().Set(HeaderSignatureInput, "sig1="+params)
+				w.Header().Set(HeaderSignature, "sig1=:"+base64.StdEncoding.EncodeToString(sig)+":")
+			}
+			fmt.Fprint(w, "ok")
+		}))
+		defer ts.Close()
+
+		clientSign, _ := NewSignatureKey(clientKey)
+		serverVerify, _ := NewSignatureKey(&serverKey.PublicKey)
+		r := New(
+			SetSigner(NewMessageSigner("client", clientSign)),
+			SetVerifier(&MessageVerifier{
+				Keys: func(keyID string) (*SignatureKey, error) {
+					return serverVerify, nil
+				},
+				Required: []string{"@status", "@method;req"},
+			}),
+		)
+
+		resp, err := r.PostJSON(context.Background(), ts.URL+"/a?b=c", map[string]string{"a": "b"})
+		So(err, ShouldBeNil)
+		So(resp.StatusCode(), ShouldEqual, http.StatusOK)
+		body, _ := resp.String()
+		So(body, ShouldEqual, "ok")
+
+		_, err = r.Get(context.Background(), ts.URL+"/unsigned", nil)
+		So(errors.Is(err, ErrInvalidSignature), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,291 @@
+package req
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redacted the replacement of the redacted values
+const redacted = "[REDACTED]"
+
+// defaultRedactHeaders the headers always redacted in the log records
+var defaultRedactHeaders = []string{
+	HeaderAuthorization,
+	HeaderProxyAuthorization,
+	HeaderCookie,
+	HeaderSetCookie,
+}
+
+// LogRecord the structured record of a completed request
+type LogRecord struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Err        error
+	Duration   time.Duration
+	// RequestSize and ResponseSize the Content-Length, -1 if unknown
+	RequestSize  int64
+	ResponseSize int64
+	// RequestDump and ResponseDump the redacted wire representation,
+	// set if LogConfig.Headers or LogConfig.Body is enabled
+	RequestDump  []byte
+	ResponseDump []byte
+}
+
+// Logger receives the log records
+type Logger interface {
+	Log(rec *LogRecord)
+}
+
+// LoggerFunc the function adapter of Logger
+type LoggerFunc func(rec *LogRecord)
+
+// Log call f(rec)
+func (f LoggerFunc) Log(rec *LogRecord) {
+	f(rec)
+}
+
+// NewStdLogger create a logger writing to the standard logger,
+// the default logger of the log package if nil
+func NewStdLogger(l *log.Logger) Logger {
+	if l == nil {
+		l = log.New(log.Writer(), "", log.LstdFlags)
+	}
+
+	return LoggerFunc(func(rec *LogRecord) {
+		var buf strings.Builder
+		buf.WriteString("req: ")
+		buf.WriteString(rec.Method)
+		buf.WriteByte(' ')
+		buf.WriteString(rec.URL)
+		if rec.Err != nil {
+			buf.WriteString(" error: ")
+			buf.WriteString(rec.Err.Error())
+		} else {
+			buf.WriteByte(' ')
+			buf.WriteString(http.StatusText(rec.StatusCode))
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(rec.Duration.String())
+		for _, dump := range [][]byte{rec.RequestDump, rec.ResponseDump} {
+			if len(dump) > 0 {
+				buf.WriteByte('\n')
+				buf.Write(dump)
+			}
+		}
+		l.Print(buf.String())
+	})
+}
+
+// LogConfig the logging options
+type LogConfig struct {
+	// Headers dump the request and response headers
+	Headers bool
+	// Body dump the request and response bodies
+	Body bool
+	// MaxBodySize the maximum size of the dumped body (default 4KB)
+	MaxBodySize int
+	// RedactHeaders the headers to redact in addition to Authorization,
+	// Proxy-Authorization, Cookie and Set-Cookie
+	RedactHeaders []string
+	// RedactFields the JSON fields whose values are redacted in the bodies
+	RedactFields []string
+}
+
+type logging struct {
+	logger        Logger
+	cfg           LogConfig
+	redactHeaders []string
+	redactFields  *regexp.Regexp
+}
+
+func newLoggerMiddleware(l Logger, cfg *LogConfig) Middleware {
+	lg := &logging{logger: l}
+	if cfg != nil {
+		lg.cfg = *cfg
+	}
+	if lg.cfg.MaxBodySize <= 0 {
+		lg.cfg.MaxBodySize = 4 << 10
+	}
+	lg.redactHeaders = append(lg.redactHeaders, defaultRedactHeaders...)
+	lg.redactHeaders = append(lg.redactHeaders, lg.cfg.RedactHeaders...)
+	if fields := lg.cfg.RedactFields; len(fields) > 0 {
+		quoted := make([]string, len(fields))
+		for i, f := range fields {
+			quoted[i] = regexp.QuoteMeta(f)
+		}
+		lg.redactFields = regexp.MustCompile(`("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+	}
+	return lg.middleware
+}
+
+func (lg *logging) dumpEnabled() bool {
+	return lg.cfg.Headers || lg.cfg.Body
+}
+
+func (lg *logging) redactHeader(h http.Header) http.Header {
+	return redactHeader(h, lg.redactHeaders)
+}
+
+// redactHeader returns a copy of the header with the values of keys redacted
+func redactHeader(h http.Header, keys []string) http.Header {
+	h = h.Clone()
+	for _, k := range keys {
+		if vs := h.Values(k); len(vs) > 0 {
+			for i := range vs {
+				vs[i] = redacted
+			}
+		}
+	}
+	return h
+}
+
+func (lg *logging) redactBody(b []byte) []byte {
+	if lg.redactFields == nil {
+		return b
+	}
+	return lg.redactFields.ReplaceAll(b, []byte(`${1}"`+redacted+`"`))
+}
+
+func (lg *logging) dump(head []byte, body *bytes.Buffer, truncated bool) []byte {
+	var buf bytes.Buffer
+	if lg.cfg.Headers {
+		buf.Write(head)
+	}
+	if lg.cfg.Body && body != nil && body.Len() > 0 {
+		buf.Write(lg.redactBody(body.Bytes()))
+		if truncated {
+			buf.WriteString("...(truncated)")
+		}
+	}
+	return buf.Bytes()
+}
+
+func (lg *logging) middleware(next Handler) Handler {
+	return func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+
+		var reqBody *captureBody
+		if lg.cfg.Body && req.Body != nil && req.Body != http.NoBody {
+			reqBody = &captureBody{ReadCloser: req.Body, limit: lg.cfg.MaxBodySize}
+			nreq := *req
+			nreq.Body = reqBody
+			req = &nreq
+		}
+
+		resp, err := next(req)
+
+		rec := &LogRecord{
+			Method:       req.Method,
+			URL:          req.URL.String(),
+			Err:          err,
+			Duration:     time.Since(start),
+			RequestSize:  req.ContentLength,
+			ResponseSize: -1,
+		}
+		if req.Body != nil && req.Body != http.NoBody && req.ContentLength == 0 {
+			rec.RequestSize = -1
+		}
+
+		if lg.dumpEnabled() {
+			dreq := *req
+			dreq.Header = lg.redactHeader(req.Header)
+			if dreq.Body != nil && dreq.Body != http.NoBody {
+				// the dump replaces it with a dummy body of the same length
+				dreq.Body = ioutil.NopCloser(strings.NewReader(""))
+			}
+			head, _ := httputil.DumpRequestOut(&dreq, false)
+			if reqBody != nil {
+				rec.RequestDump = lg.dump(head, &reqBody.buf, reqBody.truncated)
+			} else {
+				rec.RequestDump = lg.dump(head, nil, false)
+			}
+		}
+
+		if err == nil {
+			rec.StatusCode = resp.StatusCode
+			rec.ResponseSize = resp.ContentLength
+			if lg.dumpEnabled() {
+				head := lg.dumpResponseHead(resp)
+				if lg.cfg.Body && resp.Body != nil && resp.Body != http.NoBody {
+					// the body is captured as the caller reads it,
+					// the record is logged at its end
+					resp.Body = &logBody{
+						captureBody: captureBody{ReadCloser: resp.Body, limit: lg.cfg.MaxBodySize},
+						log: func(body *captureBody) {
+							rec.ResponseDump = lg.dump(head, &body.buf, body.truncated)
+							lg.logger.Log(rec)
+						},
+					}
+					return resp, nil
+				}
+				rec.ResponseDump = lg.dump(head, nil, false)
+			}
+		}
+
+		lg.logger.Log(rec)
+		return resp, err
+	}
+}
+
+// dumpResponseHead dumps the status line and the headers of the response
+func (lg *logging) dumpResponseHead(resp *http.Response) []byte {
+	dresp := *resp
+	dresp.Header = lg.redactHeader(resp.Header)
+	dresp.Body = nil
+	head, _ := httputil.DumpResponse(&dresp, false)
+	return head
+}
+
+// captureBody keeps the leading part of the body read through it
+type captureBody struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if rest := b.limit - b.buf.Len(); rest > 0 {
+		if n > rest {
+			b.buf.Write(p[:rest])
+			b.truncated = true
+		} else {
+			b.buf.Write(p[:n])
+		}
+	} else if n > 0 {
+		b.truncated = true
+	}
+	return n, err
+}
+
+// logBody captures the body read through it and logs the record
+// at the end of the body or when it's closed
+type logBody struct {
+	captureBody
+	once sync.Once
+	log  func(body *captureBody)
+}
+
+func (b *logBody) Read(p []byte) (int, error) {
+	n, err := b.captureBody.Read(p)
+	if err != nil {
+		b.once.Do(func() { b.log(&b.captureBody) })
+	}
+	return n, err
+}
+
+func (b *logBody) Close() error {
+	err := b.captureBody.Close()
+	b.once.Do(func() { b.log(&b.captureBody) })
+	return err
+}
@@ -0,0 +1,82 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogger(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret-cookie"})
+		w.Header().Set(HeaderContentType, MIMEApplicationJSON)
+		fmt.Fprintf(w, `{"echo":%s,"pad":"%s"}`, body, strings.Repeat("x", 100))
+	}))
+	defer ts.Close()
+
+	Convey("Test Logger", t, func() {
+		var records []*LogRecord
+		r := New(SetLogger(LoggerFunc(func(rec *LogRecord) {
+			records = append(records, rec)
+		}), &LogConfig{
+			Headers:      true,
+			Body:         true,
+			MaxBodySize:  64,
+			RedactFields: []string{"password"},
+		}))
+
+		resp, err := r.PostJSON(context.Background(), ts.URL, map[string]string{"password": "secret-password"},
+			SetBasicAuth("user", "secret-auth"))
+		So(err, ShouldBeNil)
+		body, err := resp.String()
+		So(err, ShouldBeNil)
+		So(body, ShouldContainSubstring, "secret-password")
+		So(body, ShouldEndWith, `"}`)
+
+		So(len(records), ShouldEqual, 1)
+		rec := records[0]
+		So(rec.Method, ShouldEqual, http.MethodPost)
+		So(rec.StatusCode, ShouldEqual, http.StatusOK)
+
+		reqDump, respDump := string(rec.RequestDump), string(rec.ResponseDump)
+		So(reqDump, ShouldContainSubstring, "Authorization: "+redacted)
+		So(reqDump, ShouldContainSubstring, `{"password":"`+redacted+`"}`)
+		So(reqDump, ShouldNotContainSubstring, "secret")
+		So(respDump, ShouldContainSubstring, "Set-Cookie: "+redacted)
+		So(respDump, ShouldContainSubstring, "...(truncated)")
+		So(respDump, ShouldNotContainSubstring, "secret")
+	})
+	Convey("Test Logger Streaming Response", t, func() {
+		release := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "first")
+			w.(http.Flusher).Flush()
+			<-release
+			fmt.Fprint(w, " last")
+		}))
+		defer ts.Close()
+
+		records := make(chan *LogRecord, 1)
+		r := New(SetLogger(LoggerFunc(func(rec *LogRecord) {
+			records <- rec
+		}), &LogConfig{Body: true}))
+
+		// the response is returned before the body ends
+		resp, err := r.Get(context.Background(), ts.URL, nil)
+		close(release)
+		So(err, ShouldBeNil)
+		So(len(records), ShouldEqual, 0)
+
+		body, err := resp.String()
+		So(err, ShouldBeNil)
+		So(body, ShouldEqual, "first last")
+		So(string((<-records).ResponseDump), ShouldEqual, "first last")
+	})
+}
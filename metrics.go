@@ -0,0 +1,206 @@
+package req
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metric the result of a completed request
+type Metric struct {
+	Method string
+	Host   string
+	// Route the route template set by SetRoute, empty if not set since
+	// the URL paths with ids would make unbounded series
+	Route string
+	// StatusCode the response status code, zero if no response was received
+	StatusCode int
+	Err        error
+	Duration   time.Duration
+}
+
+// StatusClass the status class of the metric, such as "2xx",
+// "error" if no response was received
+func (m *Metric) StatusClass() string {
+	if m.StatusCode <= 0 {
+		return "error"
+	}
+	return fmt.Sprintf("%dxx", m.StatusCode/100)
+}
+
+// MetricsRecorder records the completed requests
+type MetricsRecorder interface {
+	Record(m *Metric)
+}
+
+// MetricsRecorderFunc the function adapter of MetricsRecorder
+type MetricsRecorderFunc func(m *Metric)
+
+// Record call f(m)
+func (f MetricsRecorderFunc) Record(m *Metric) {
+	f(m)
+}
+
+var (
+	_ MetricsRecorder = &MemoryMetrics{}
+	_ expvar.Var      = &MemoryMetrics{}
+)
+
+// DefaultMetricsBuckets the default latency histogram buckets
+var DefaultMetricsBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// NewMemoryMetrics create an in-memory metrics recorder with the latency
+// histogram buckets, DefaultMetricsBuckets if none
+func NewMemoryMetrics(buckets ...time.Duration) *MemoryMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultMetricsBuckets
+	}
+	b := make([]time.Duration, len(buckets))
+	copy(b, buckets)
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+
+	return &MemoryMetrics{buckets: b}
+}
+
+// MemoryMetrics the in-memory metrics recorder, series are grouped by
+// method, host, route and status class
+type MemoryMetrics struct {
+	buckets []time.Duration
+	series  sync.Map
+}
+
+type metricsKey struct {
+	method, host, route, class string
+}
+
+type metricsSeries struct {
+	count   int64
+	errors  int64
+	sum     int64
+	buckets []int64
+}
+
+// Record record the completed request
+func (m *MemoryMetrics) Record(metric *Metric) {
+	key := metricsKey{
+		method: metric.Method,
+		host:   metric.Host,
+		route:  metric.Route,
+		class:  metric.StatusClass(),
+	}
+
+	v, ok := m.series.Load(key)
+	if !ok {
+		v, _ = m.series.LoadOrStore(key, &metricsSeries{
+			buckets: make([]int64, len(m.buckets)+1),
+		})
+	}
+	s := v.(*metricsSeries)
+
+	atomic.AddInt64(&s.count, 1)
+	if metric.Err != nil {
+		atomic.AddInt64(&s.errors, 1)
+	}
+	atomic.AddInt64(&s.sum, int64(metric.Duration))
+
+	i := sort.Search(len(m.buckets), func(i int) bool { return metric.Duration <= m.buckets[i] })
+	atomic.AddInt64(&s.buckets[i], 1)
+}
+
+// MetricsSeries the snapshot of a metrics series
+type MetricsSeries struct {
+	Method      string          `json:"method"`
+	Host        string          `json:"host"`
+	Route       string          `json:"route"`
+	StatusClass string          `json:"status_class"`
+	Count       int64           `json:"count"`
+	Errors      int64           `json:"errors"`
+	Sum         time.Duration   `json:"sum"`
+	Buckets     []MetricsBucket `json:"buckets"`
+}
+
+// MetricsBucket the cumulative count of the requests completed
+// within the upper bound, the last bucket is unbounded
+type MetricsBucket struct {
+	UpperBound time.Duration `json:"le"`
+	Count      int64         `json:"count"`
+}
+
+// Snapshot returns the current series sorted by method, host, route
+// and status class
+func (m *MemoryMetrics) Snapshot() []MetricsSeries {
+	list := make([]MetricsSeries, 0)
+	m.series.Range(func(k, v interface{}) bool {
+		key, s := k.(metricsKey), v.(*metricsSeries)
+
+		item := MetricsSeries{
+			Method:      key.method,
+			Host:        key.host,
+			Route:       key.route,
+			StatusClass: key.class,
+			Count:       atomic.LoadInt64(&s.count),
+			Errors:      atomic.LoadInt64(&s.errors),
+			Sum:         time.Duration(atomic.LoadInt64(&s.sum)),
+			Buckets:     make([]MetricsBucket, len(s.buckets)),
+		}
+
+		var n int64
+		for i := range s.buckets {
+			n += atomic.LoadInt64(&s.buckets[i])
+			bound := time.Duration(math.MaxInt64)
+			if i < len(m.buckets) {
+				bound = m.buckets[i]
+			}
+			item.Buckets[i] = MetricsBucket{UpperBound: bound, Count: n}
+		}
+		list = append(list, item)
+		return true
+	})
+
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Method != b.Method {
+			return a.Method < b.Method
+		}
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Route != b.Route {
+			return a.Route < b.Route
+		}
+		return a.StatusClass < b.StatusClass
+	})
+	return list
+}
+
+// String returns the snapshot in JSON, it implements expvar.Var
+func (m *MemoryMetrics) String() string {
+	b, err := json.Marshal(m.Snapshot())
+	if err != nil {
+		return "null"
+	}
+	return string(b)
+}
+
+// Publish exports the metrics as the expvar variable name,
+// it panics if the name is already registered
+func (m *MemoryMetrics) Publish(name string) {
+	expvar.Publish(name, m)
+}
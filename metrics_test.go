@@ -0,0 +1,53 @@
+package req
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	Convey("Test Metrics Recorder", t, func() {
+		m := NewMemoryMetrics()
+		r := New(SetMetrics(m))
+
+		for _, id := range []string{"1", "2"} {
+			resp, err := r.Get(context.Background(), ts.URL+"/users/"+id, nil, SetRoute("/users/{id}"))
+			So(err, ShouldBeNil)
+			resp.Close()
+		}
+		_, err := r.Get(context.Background(), ts.URL+"/fail", nil, SetRequestFailOnErrorStatus())
+		So(err, ShouldNotBeNil)
+		_, err = r.Get(context.Background(), "http://127.0.0.1:0/", nil)
+		So(err, ShouldNotBeNil)
+
+		u, _ := url.Parse(ts.URL)
+		snapshot := m.Snapshot()
+		So(len(snapshot), ShouldEqual, 3)
+		So(snapshot[1].Host, ShouldEqual, u.Host)
+		So(snapshot[1].Route, ShouldEqual, "")
+		So(snapshot[1].StatusClass, ShouldEqual, "5xx")
+		So(snapshot[1].Errors, ShouldEqual, 1)
+		So(snapshot[2].Route, ShouldEqual, "/users/{id}")
+		So(snapshot[2].StatusClass, ShouldEqual, "2xx")
+		So(snapshot[2].Count, ShouldEqual, 2)
+		So(snapshot[2].Buckets[len(snapshot[2].Buckets)-1].Count, ShouldEqual, 2)
+		So(snapshot[0].StatusClass, ShouldEqual, "error")
+
+		var v []MetricsSeries
+		So(json.Unmarshal([]byte(m.String()), &v), ShouldBeNil)
+		So(v, ShouldResemble, snapshot)
+	})
+}
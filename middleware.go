@@ -0,0 +1,22 @@
+package req
+
+import (
+	"net/http"
+)
+
+// Handler sends the HTTP request and returns the HTTP response
+type Handler func(req *http.Request) (*http.Response, error)
+
+// Middleware wraps the next handler to extend the request/response cycle
+type Middleware func(next Handler) Handler
+
+// chainMiddleware wraps the handler with the middlewares,
+// the first middleware is the outermost one
+func chainMiddleware(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		if mw := mws[i]; mw != nil {
+			h = mw(h)
+		}
+	}
+	return h
+}
@@ -0,0 +1,43 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMiddleware(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Trace"))
+	}))
+	defer ts.Close()
+
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(req *http.Request) (*http.Response, error) {
+				req.Header.Add("Trace", name)
+				resp, err := next(req)
+				if err == nil {
+					resp.Header.Add("Trace", name)
+				}
+				return resp, err
+			}
+		}
+	}
+
+	Convey("Test Middleware", t, func() {
+		r := New(SetMiddleware(trace("a"), trace("b")))
+
+		resp, err := r.Get(context.Background(), ts.URL, nil, SetRequestMiddleware(trace("c")))
+		So(err, ShouldBeNil)
+		So(resp.Response().Header["Trace"], ShouldResemble, []string{"c", "b", "a"})
+
+		body, err := resp.String()
+		So(err, ShouldBeNil)
+		So(body, ShouldEqual, "a")
+	})
+}
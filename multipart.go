@@ -0,0 +1,303 @@
+package req
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FormFile the file part of a multipart form
+type FormFile struct {
+	// FieldName the form field name
+	FieldName string
+	// FileName the file name sent to the server
+	FileName string
+	// ContentType the part Content-Type, detected from the file name
+	// extension by default
+	ContentType string
+	// Size the part size, -1 if unknown
+	Size int64
+
+	open       func() (io.ReadCloser, error)
+	stat       func() (int64, error)
+	replayable bool
+}
+
+// NewFormFile create a file part read from r, the size is known
+// for *bytes.Buffer, *bytes.Reader and *strings.Reader
+func NewFormFile(fieldName, fileName string, r io.Reader) *FormFile {
+	size := int64(-1)
+	switch v := r.(type) {
+	case *bytes.Buffer:
+		size = int64(v.Len())
+	case *bytes.Reader:
+		size = int64(v.Len())
+	case *strings.Reader:
+		size = int64(v.Len())
+	}
+
+	used := false
+	return &FormFile{
+		FieldName:   fieldName,
+		FileName:    fileName,
+		ContentType: detectContentType(fileName),
+		Size:        size,
+		open: func() (io.ReadCloser, error) {
+			if used {
+				return nil, errors.New("req: form file reader can't be read twice")
+			}
+			used = true
+			return ioutil.NopCloser(r), nil
+		},
+	}
+}
+
+// NewFormFileFromPath create a file part read from the local file
+func NewFormFileFromPath(fieldName, path string) *FormFile {
+	return &FormFile{
+		FieldName:   fieldName,
+		FileName:    filepath.Base(path),
+		ContentType: detectContentType(path),
+		Size:        -1,
+		open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+		stat: func() (int64, error) {
+			fi, err := os.Stat(path)
+			if err != nil {
+				return 0, err
+			}
+			return fi.Size(), nil
+		},
+		replayable: true,
+	}
+}
+
+// NewFormFileFromFS create a file part read from the file system
+func NewFormFileFromFS(fieldName string, fsys fs.FS, name string) *FormFile {
+	return &FormFile{
+		FieldName:   fieldName,
+		FileName:    filepath.Base(name),
+		ContentType: detectContentType(name),
+		Size:        -1,
+		open: func() (io.ReadCloser, error) {
+			return fsys.Open(name)
+		},
+		stat: func() (int64, error) {
+			fi, err := fs.Stat(fsys, name)
+			if err != nil {
+				return 0, err
+			}
+			return fi.Size(), nil
+		},
+		replayable: true,
+	}
+}
+
+func detectContentType(name string) string {
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		return ct
+	}
+	return MIMEOctetStream
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func (f *FormFile) header() textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	h.Set(HeaderContentDisposition, fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(f.FieldName), quoteEscaper.Replace(f.FileName)))
+	ct := f.ContentType
+	if ct == "" {
+		ct = MIMEOctetStream
+	}
+	h.Set(HeaderContentType, ct)
+	return h
+}
+
+type multipartBody struct {
+	boundary string
+	fields   map[string][]string
+	files    []*FormFile
+	// sizes the part sizes of the files, measured once for the body
+	sizes []int64
+}
+
+func newMultipartBody(fields map[string][]string, files []*FormFile) (*multipartBody, error) {
+	sizes := make([]int64, len(files))
+	for i, f := range files {
+		sizes[i] = f.Size
+		if sizes[i] < 0 && f.stat != nil {
+			size, err := f.stat()
+			if err != nil {
+				return nil, err
+			}
+			sizes[i] = size
+		}
+	}
+
+	return &multipartBody{
+		boundary: multipart.NewWriter(nil).Boundary(),
+		fields:   fields,
+		files:    files,
+		sizes:    sizes,
+	}, nil
+}
+
+func (b *multipartBody) contentType() string {
+	return MIMEMultipartForm + "; boundary=" + b.boundary
+}
+
+// size returns the encoded body size, -1 if any part size is unknown
+func (b *multipartBody) size() int64 {
+	var n int64
+	for _, size := range b.sizes {
+		if size < 0 {
+			return -1
+		}
+		n += size
+	}
+
+	cw := &countWriter{}
+	if err := b.write(cw, false); err != nil {
+		return -1
+	}
+	return n + cw.n
+}
+
+func (b *multipartBody) replayable() bool {
+	for _, f := range b.files {
+		if !f.replayable {
+			return false
+		}
+	}
+	return true
+}
+
+// write encodes the body, the file contents are skipped if withContent is false
+func (b *multipartBody) write(w io.Writer, withContent bool) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(b.boundary); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(b.fields))
+	for k := range b.fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range b.fields[k] {
+			if err := mw.WriteField(k, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, f := range b.files {
+		pw, err := mw.CreatePart(f.header())
+		if err != nil {
+			return err
+		}
+		if !withContent {
+			continue
+		}
+
+		rc, err := f.open()
+		if err != nil {
+			return err
+		}
+		err = copyPart(pw, rc, f.FileName, b.sizes[i])
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// copyPart copies the file content, exactly size bytes if the size is known
+// as the Content-Length is computed from it
+func copyPart(w io.Writer, r io.Reader, name string, size int64) error {
+	if size < 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	n, err := io.Copy(w, io.LimitReader(r, size))
+	if err != nil {
+		return err
+	}
+	if n < size {
+		return fmt.Errorf("req: form file %q is shorter than its size %d", name, size)
+	}
+	return nil
+}
+
+// reader returns the body streamed through a pipe,
+// the encoding starts on the first read
+func (b *multipartBody) reader() io.ReadCloser {
+	pr, pw := io.Pipe()
+	return &lazyPipeReader{
+		pr: pr,
+		start: func() {
+			go func() {
+				pw.CloseWithError(b.write(pw, true))
+			}()
+		},
+	}
+}
+
+type lazyPipeReader struct {
+	pr      *io.PipeReader
+	start   func()
+	started bool
+}
+
+func (r *lazyPipeReader) Read(p []byte) (int, error) {
+	if !r.started {
+		r.started = true
+		r.start()
+	}
+	return r.pr.Read(p)
+}
+
+func (r *lazyPipeReader) Close() error {
+	return r.pr.Close()
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// setMultipartBody sets the Content-Type, Content-Length and GetBody
+// of the request
+func setMultipartBody(b *multipartBody) RequestOption {
+	return func(o *requestOptions) {
+		o.request.Header.Set(HeaderContentType, b.contentType())
+		if n := b.size(); n >= 0 {
+			o.request.ContentLength = n
+		}
+		if b.replayable() {
+			o.request.GetBody = func() (io.ReadCloser, error) {
+				return b.reader(), nil
+			}
+		}
+	}
+}
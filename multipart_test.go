@@ -0,0 +1,110 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMultipart(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(500)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+
+		var parts []string
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				w.WriteHeader(500)
+				fmt.Fprint(w, err.Error())
+				return
+			}
+			b, _ := ioutil.ReadAll(p)
+			parts = append(parts, fmt.Sprintf("%s|%s|%s|%s", p.FormName(), p.FileName(), p.Header.Get(HeaderContentType), b))
+		}
+		fmt.Fprintf(w, "%d\n%s", r.ContentLength, strings.Join(parts, "\n"))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "req")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(path, []byte("file a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Test Multipart Request", t, func() {
+		r := New()
+
+		fsys := fstest.MapFS{"b.json": {Data: []byte(`{"b":1}`)}}
+		fields := url.Values{"foo": {"bar"}}
+		files := []*FormFile{
+			NewFormFileFromPath("a", path),
+			NewFormFileFromFS("b", fsys, "b.json"),
+		}
+		resp, err := r.PostMultipart(context.Background(), ts.URL, fields, files)
+		So(err, ShouldBeNil)
+		body, err := resp.String()
+		So(err, ShouldBeNil)
+		lines := strings.Split(body, "\n")
+		So(lines[0], ShouldNotEqual, "-1")
+		So(lines[1:], ShouldResemble, []string{
+			"foo|||bar",
+			"a|a.txt|text/plain; charset=utf-8|file a",
+			"b|b.json|application/json|{\"b\":1}",
+		})
+
+		f := NewFormFile("c", "c.bin", io.MultiReader(strings.NewReader("stream")))
+		resp, err = r.PutMultipart(context.Background(), ts.URL, nil, []*FormFile{f})
+		So(err, ShouldBeNil)
+		body, err = resp.String()
+		So(err, ShouldBeNil)
+		So(body, ShouldEqual, "-1\nc|c.bin|application/octet-stream|stream")
+	})
+	Convey("Test Multipart File Size", t, func() {
+		r := New()
+
+		// the measured size isn't kept in the file part
+		f := NewFormFileFromPath("a", path)
+		resp, err := r.PostMultipart(context.Background(), ts.URL, nil, []*FormFile{f})
+		So(err, ShouldBeNil)
+		resp.Close()
+		So(f.Size, ShouldEqual, -1)
+
+		// the part is limited to its size
+		f = NewFormFile("c", "c.txt", strings.NewReader("content"))
+		f.Size = 4
+		resp, err = r.PostMultipart(context.Background(), ts.URL, nil, []*FormFile{f})
+		So(err, ShouldBeNil)
+		body, err := resp.String()
+		So(err, ShouldBeNil)
+		So(body, ShouldEndWith, "c|c.txt|text/plain; charset=utf-8|cont")
+
+		// the part shorter than its size fails
+		f = NewFormFile("c", "c.txt", strings.NewReader("content"))
+		f.Size = 100
+		_, err = r.PostMultipart(context.Background(), ts.URL, nil, []*FormFile{f})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, `form file "c.txt" is shorter than its size`)
+	})
+}
@@ -0,0 +1,229 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenExpirySkew the token is refreshed this long before it expires
+const tokenExpirySkew = 30 * time.Second
+
+// Token the OAuth2 token
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresIn    int64     `json:"expires_in,omitempty"`
+	Expiry       time.Time `json:"-"`
+}
+
+// Type returns the token type, Bearer by default
+func (t *Token) Type() string {
+	if t.TokenType == "" || strings.EqualFold(t.TokenType, "bearer") {
+		return "Bearer"
+	}
+	return t.TokenType
+}
+
+// Valid reports whether the token is set and not about to expire
+func (t *Token) Valid() bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Now().Add(tokenExpirySkew).Before(t.Expiry)
+}
+
+// TokenSource supplies the OAuth2 tokens
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenSourceFunc the function adapter of TokenSource
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+// Token call f(ctx)
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+var (
+	_ TokenSource = &ClientCredentials{}
+	_ TokenSource = &RefreshToken{}
+	_ TokenSource = &TokenCache{}
+)
+
+// ClientCredentials the client credentials grant (RFC 6749 4.4)
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Params the additional token request parameters, such as audience
+	Params url.Values
+	// Requester the requester of the token endpoint, a new one if nil
+	Requester Requester
+}
+
+// Token requests a new token from the token endpoint
+func (c *ClientCredentials) Token(ctx context.Context) (*Token, error) {
+	form := url.Values{}
+	for k, v := range c.Params {
+		form[k] = v
+	}
+	form.Set("grant_type", "client_credentials")
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	return requestToken(ctx, c.Requester, c.TokenURL, c.ClientID, c.ClientSecret, form)
+}
+
+// RefreshToken the refresh token grant (RFC 6749 6), the refresh token
+// is replaced when the server rotates it
+type RefreshToken struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+	Scopes       []string
+	// Requester the requester of the token endpoint, a new one if nil
+	Requester Requester
+
+	mu sync.Mutex
+}
+
+// Token requests a new token from the token endpoint
+func (c *RefreshToken) Token(ctx context.Context) (*Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", c.RefreshToken)
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+
+	token, err := requestToken(ctx, c.Requester, c.TokenURL, c.ClientID, c.ClientSecret, form)
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken != "" {
+		c.RefreshToken = token.RefreshToken
+	}
+	return token, nil
+}
+
+func requestToken(ctx context.Context, r Requester, tokenURL, clientID, clientSecret string, form url.Values) (*Token, error) {
+	if r == nil {
+		r = New()
+	}
+
+	var opts []RequestOption
+	opts = append(opts, SetHeader(HeaderAccept, MIMEApplicationJSON), SetRequestFailOnErrorStatus())
+	if clientID != "" {
+		opts = append(opts, SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret)))
+	}
+
+	resp, err := r.PostForm(ctx, tokenURL, form, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	token := new(Token)
+	if err := resp.JSON(token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("req: token response without access_token")
+	}
+	if token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// NewTokenCache create a token source caching the tokens of src until
+// shortly before they expire, concurrent callers share a single refresh
+func NewTokenCache(src TokenSource) *TokenCache {
+	return &TokenCache{src: src}
+}
+
+// TokenCache the caching token source
+type TokenCache struct {
+	src   TokenSource
+	mu    sync.Mutex
+	token *Token
+	call  *tokenCall
+}
+
+type tokenCall struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+// Token returns the cached token, refreshing it if it's about to expire
+func (c *TokenCache) Token(ctx context.Context) (*Token, error) {
+	c.mu.Lock()
+	if c.token.Valid() {
+		token := c.token
+		c.mu.Unlock()
+		return token, nil
+	}
+
+	// the shared refresh isn't canceled with the caller starting it
+	call := c.call
+	if call == nil {
+		call = &tokenCall{done: make(chan struct{})}
+		c.call = call
+		go c.refresh(detachContext(ctx), call)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *TokenCache) refresh(ctx context.Context, call *tokenCall) {
+	defer close(call.done)
+	defer func() {
+		c.mu.Lock()
+		if call.err == nil {
+			c.token = call.token
+		}
+		c.call = nil
+		c.mu.Unlock()
+	}()
+	call.token, call.err = c.src.Token(ctx)
+}
+
+// Invalidate drops the cached token, the next call gets a new one
+func (c *TokenCache) Invalidate() {
+	c.mu.Lock()
+	c.token = nil
+	c.mu.Unlock()
+}
+
+// detachedContext keeps the values of the parent context
+// without its deadline and cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+// detachContext returns a context with the values of ctx which is never canceled
+func detachContext(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -0,0 +1,98 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOAuth2(t *testing.T) {
+	var issued int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			id, secret, _ := r.BasicAuth()
+			if id != "client" || secret != "secret" || r.PostFormValue("grant_type") != "client_credentials" ||
+				r.PostFormValue("scope") != "read write" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error":"invalid_client"}`)
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+			n := atomic.AddInt32(&issued, 1)
+			w.Header().Set(HeaderContentType, MIMEApplicationJSON)
+			fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":3600}`, n)
+		default:
+			fmt.Fprint(w, r.Header.Get(HeaderAuthorization))
+		}
+	}))
+	defer ts.Close()
+
+	Convey("Test OAuth2 Token Source", t, func() {
+		r := New(SetTokenSource(&ClientCredentials{
+			TokenURL:     ts.URL + "/token",
+			ClientID:     "client",
+			ClientSecret: "secret",
+			Scopes:       []string{"read", "write"},
+		}))
+
+		var wg sync.WaitGroup
+		bodies := make([]string, 10)
+		for i := range bodies {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				resp, err := r.Get(context.Background(), ts.URL+"/api", nil)
+				if err == nil {
+					bodies[i], _ = resp.String()
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		So(atomic.LoadInt32(&issued), ShouldEqual, 1)
+		for _, body := range bodies {
+			So(body, ShouldEqual, "Bearer token-1")
+		}
+
+		r = New(SetTokenSource(&ClientCredentials{TokenURL: ts.URL + "/token", ClientID: "bad"}))
+		_, err := r.Get(context.Background(), ts.URL+"/api", nil)
+		So(err, ShouldNotBeNil)
+	})
+	Convey("Test Token Cache Canceled Caller", t, func() {
+		var calls int32
+		c := NewTokenCache(TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+			atomic.AddInt32(&calls, 1)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(50 * time.Millisecond):
+			}
+			return &Token{AccessToken: "shared", Expiry: time.Now().Add(time.Hour)}, nil
+		}))
+
+		// the caller starting the refresh gives up
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		done := make(chan error, 1)
+		go func() {
+			_, err := c.Token(ctx)
+			done <- err
+		}()
+		time.Sleep(5 * time.Millisecond)
+
+		// the other callers still get the shared token
+		token, err := c.Token(context.Background())
+		So(err, ShouldBeNil)
+		So(token.AccessToken, ShouldEqual, "shared")
+		So(<-done == context.DeadlineExceeded, ShouldBeTrue)
+		So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+	})
+}
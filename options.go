@@ -128,11 +128,28 @@ var defaultOptions = options{
 
 type options struct {
 	transport     *http.Transport
+	roundTripper  http.RoundTripper
 	cookieJar     http.CookieJar
 	checkRedirect func(req *http.Request, via []*http.Request) error
 	timeout       time.Duration
 	baseURL       string
 	header        http.Header
+	retry         *Retry
+	middlewares   []Middleware
+	status        *statusChecker
+	codecs        codecRegistry
+	trace         bool
+	metrics       MetricsRecorder
+	signers       []Signer
+	contentDigest []string
+	rateLimiter   *RateLimiter
+	throttler     *Throttler
+	breaker       *CircuitBreaker
+	balancer      *Balancer
+	cache         *httpCache
+	har           *HARRecorder
+	// cacheMaxEntrySize the maximum body size of the cached responses
+	cacheMaxEntrySize int64
 }
 
 // Option parameter options
@@ -145,6 +162,20 @@ func SetBaseURL(base string) Option {
 	}
 }
 
+// SetBaseURLs balance the requests with a relative URL across the base
+// urls in turn, see SetBalancer
+func SetBaseURLs(bases ...string) Option {
+	return SetBalancer(NewBalancer(RoundRobin, bases...))
+}
+
+// SetBalancer balance the requests with a relative URL across the base
+// urls of the balancer, it takes precedence over SetBaseURL
+func SetBalancer(b *Balancer) Option {
+	return func(o *options) {
+		o.balancer = b
+	}
+}
+
 // SetBaseHeader set the requested base header
 func SetBaseHeader(key, value string) Option {
 	return func(o *options) {
@@ -164,6 +195,14 @@ func SetTransport(tr *http.Transport) Option {
 	}
 }
 
+// SetRoundTripper specifies the round tripper making the requests,
+// it takes precedence over SetTransport
+func SetRoundTripper(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.roundTripper = rt
+	}
+}
+
 // SetCookieJar specifies the cookie jar
 func SetCookieJar(jar http.CookieJar) Option {
 	return func(o *options) {
@@ -185,9 +224,196 @@ func SetTimeout(d time.Duration) Option {
 	}
 }
 
+// SetRetry specifies the retry policy for failed requests
+func SetRetry(retry *Retry) Option {
+	return func(o *options) {
+		o.retry = retry
+	}
+}
+
+// SetMiddleware appends the middlewares wrapping every request,
+// the first middleware is the outermost one
+func SetMiddleware(mw ...Middleware) Option {
+	return func(o *options) {
+		o.middlewares = append(o.middlewares, mw...)
+	}
+}
+
+// SetExpectStatus specifies the expected response status codes,
+// any other status code is returned as a *StatusError
+func SetExpectStatus(codes ...int) Option {
+	return func(o *options) {
+		o.status = &statusChecker{codes: codes}
+	}
+}
+
+// SetFailOnErrorStatus returns the 4xx and 5xx responses as a *StatusError
+func SetFailOnErrorStatus() Option {
+	return func(o *options) {
+		o.status = &statusChecker{}
+	}
+}
+
+// SetCodec registers the codecs keyed by their content type,
+// replacing the built-in codecs of the same media type
+func SetCodec(codecs ...Codec) Option {
+	return func(o *options) {
+		m := make(codecRegistry)
+		for k, v := range o.codecs {
+			m[k] = v
+		}
+		for _, c := range codecs {
+			m[mediaType(c.ContentType())] = c
+		}
+		o.codecs = m
+	}
+}
+
+// SetCache enables the private HTTP cache storing the GET responses
+// in the store, it's appended to the middlewares
+func SetCache(store CacheStore) Option {
+	return setCache(store, false)
+}
+
+// SetSharedCache enables the shared HTTP cache, it doesn't store the
+// private responses and the responses to authorized requests
+func SetSharedCache(store CacheStore) Option {
+	return setCache(store, true)
+}
+
+func setCache(store CacheStore, shared bool) Option {
+	return func(o *options) {
+		c := newHTTPCache(store, shared)
+		o.cache = c
+		o.middlewares = append(o.middlewares, c.middleware)
+	}
+}
+
+// SetCacheMaxEntrySize set the maximum body size of the cached responses,
+// the larger responses aren't stored, DefaultCacheMaxEntrySize by default
+func SetCacheMaxEntrySize(size int64) Option {
+	return func(o *options) {
+		o.cacheMaxEntrySize = size
+	}
+}
+
+// SetTrace records the timings of every request, see Responser.Timings
+func SetTrace() Option {
+	return func(o *options) {
+		o.trace = true
+	}
+}
+
+// SetMetrics specifies the recorder of every completed request
+func SetMetrics(rec MetricsRecorder) Option {
+	return func(o *options) {
+		o.metrics = rec
+	}
+}
+
+// SetLogger logs every request to the logger, the headers and bodies
+// are dumped as configured by cfg (nil logs the summary only),
+// it's appended to the middlewares
+func SetLogger(l Logger, cfg *LogConfig) Option {
+	return SetMiddleware(newLoggerMiddleware(l, cfg))
+}
+
+// SetHAR captures every attempt sent to the server into the HAR recorder,
+// including the retries and the replays, the archive is written by
+// HARRecorder.Flush
+func SetHAR(h *HARRecorder) Option {
+	return func(o *options) {
+		o.har = h
+	}
+}
+
+// SetTokenSource sets the Authorization header of every request to the
+// OAuth2 token of the source, the tokens are cached by a TokenCache and
+// refreshed when rejected, see SetAuthenticator
+func SetTokenSource(ts TokenSource) Option {
+	cache, ok := ts.(*TokenCache)
+	if !ok {
+		cache = NewTokenCache(ts)
+	}
+	return SetAuthenticator(&tokenAuthenticator{cache: cache})
+}
+
+// SetAuthenticator authenticates every request, on a 401 response with
+// a WWW-Authenticate challenge the credential is refreshed once and the
+// request is replayed, it's appended to the middlewares
+func SetAuthenticator(a Authenticator) Option {
+	return SetMiddleware(newAuthMiddleware(a))
+}
+
+// SetSigner appends the signers of every request, they run in order
+// before every attempt, such as NewSigV4 and NewMessageSigner
+func SetSigner(signers ...Signer) Option {
+	return func(o *options) {
+		o.signers = append(o.signers, signers...)
+	}
+}
+
+// SetContentDigest computes the Content-Digest of every request body with
+// the algorithms (sha-256 by default) before the signers run, the bodies
+// that can't be read again are sent chunked with the digest in the trailer
+func SetContentDigest(algorithms ...string) Option {
+	return func(o *options) {
+		o.contentDigest = digestAlgorithms(algorithms)
+	}
+}
+
+// SetVerifyDigest verifies the Content-Digest, Repr-Digest and Content-MD5
+// of every response as the body is read, a mismatch is returned as a
+// *DigestError by the body reads, it's appended to the middlewares
+func SetVerifyDigest() Option {
+	return SetMiddleware(newVerifyDigestMiddleware())
+}
+
+// SetRateLimiter paces every attempt with the rate limiter, the limiter
+// can be shared by several clients
+func SetRateLimiter(l *RateLimiter) Option {
+	return func(o *options) {
+		o.rateLimiter = l
+	}
+}
+
+// SetThrottler delays every attempt by the rate limits the hosts announce,
+// see Throttler.States for the current state of every host
+func SetThrottler(t *Throttler) Option {
+	return func(o *options) {
+		o.throttler = t
+	}
+}
+
+// SetCircuitBreaker fails the attempts to the hosts with an open circuit
+// with ErrCircuitOpen, they aren't retried
+func SetCircuitBreaker(b *CircuitBreaker) Option {
+	return func(o *options) {
+		o.breaker = b
+	}
+}
+
+// SetVerifier verifies the message signature of every response, the
+// unverified responses are returned as an error wrapping
+// ErrInvalidSignature, it's appended to the middlewares
+func SetVerifier(v *MessageVerifier) Option {
+	return SetMiddleware(newVerifierMiddleware(v))
+}
+
 type requestOptions struct {
-	request *http.Request
-	handle  func(req *http.Request) (*http.Request, error)
+	request       *http.Request
+	handle        func(req *http.Request) (*http.Request, error)
+	retry         *Retry
+	middlewares   []Middleware
+	status        *statusChecker
+	trace         bool
+	route         string
+	digest        *digestAuth
+	signers       []Signer
+	contentDigest []string
+	hedge         *Hedge
+	endpoint      *endpoint
+	target        string
 }
 
 // RequestOption request parameter options
@@ -208,6 +434,15 @@ func SetBasicAuth(username, password string) RequestOption {
 	}
 }
 
+// SetDigestAuth sets the request to use HTTP Digest Authentication with
+// the provided username and password, the challenge is answered by
+// replaying the request and then preemptively for the same realm.
+func SetDigestAuth(username, password string) RequestOption {
+	return func(o *requestOptions) {
+		o.digest = &digestAuth{username: username, password: password}
+	}
+}
+
 // SetContentType set the Content-Type
 func SetContentType(contentType string) RequestOption {
 	return func(o *requestOptions) {
@@ -221,3 +456,97 @@ func SetRequest(handle func(req *http.Request) (*http.Request, error)) RequestOp
 		o.handle = handle
 	}
 }
+
+// SetRequestRetry overrides the client retry policy for the request,
+// a nil policy or a zero Count disables retrying
+func SetRequestRetry(retry *Retry) RequestOption {
+	return func(o *requestOptions) {
+		o.retry = retry
+	}
+}
+
+// SetRequestMiddleware appends the middlewares wrapping the request,
+// they run inside the client middlewares
+func SetRequestMiddleware(mw ...Middleware) RequestOption {
+	return func(o *requestOptions) {
+		o.middlewares = append(o.middlewares, mw...)
+	}
+}
+
+// SetRequestExpectStatus specifies the expected response status codes
+// of the request, overriding the client setting
+func SetRequestExpectStatus(codes ...int) RequestOption {
+	return func(o *requestOptions) {
+		o.status = &statusChecker{codes: codes}
+	}
+}
+
+// SetRequestFailOnErrorStatus returns the 4xx and 5xx responses of the
+// request as a *StatusError, overriding the client setting
+func SetRequestFailOnErrorStatus() RequestOption {
+	return func(o *requestOptions) {
+		o.status = &statusChecker{}
+	}
+}
+
+// SetRequestTrace records the timings of the request, see Responser.Timings
+func SetRequestTrace() RequestOption {
+	return func(o *requestOptions) {
+		o.trace = true
+	}
+}
+
+// SetRoute set the route template of the request reported to the metrics
+// recorder, such as "/users/{id}"
+func SetRoute(route string) RequestOption {
+	return func(o *requestOptions) {
+		o.route = route
+	}
+}
+
+// SetCurlLog calls logf with the curl command line of the request
+func SetCurlLog(logf func(cmd string)) RequestOption {
+	return SetRequestMiddleware(newCurlMiddleware(logf))
+}
+
+// SetRequestSigner appends the signers of the request,
+// they run after the client signers
+func SetRequestSigner(signers ...Signer) RequestOption {
+	return func(o *requestOptions) {
+		o.signers = append(o.signers[:len(o.signers):len(o.signers)], signers...)
+	}
+}
+
+// SetRequestVerifier verifies the message signature of the response
+func SetRequestVerifier(v *MessageVerifier) RequestOption {
+	return SetRequestMiddleware(newVerifierMiddleware(v))
+}
+
+// SetRequestContentDigest computes the Content-Digest of the request body
+// with the algorithms (sha-256 by default), overriding the client setting
+func SetRequestContentDigest(algorithms ...string) RequestOption {
+	return func(o *requestOptions) {
+		o.contentDigest = digestAlgorithms(algorithms)
+	}
+}
+
+// SetRequestVerifyDigest verifies the digests of the response
+func SetRequestVerifyDigest() RequestOption {
+	return SetRequestMiddleware(newVerifyDigestMiddleware())
+}
+
+func digestAlgorithms(algorithms []string) []string {
+	if len(algorithms) == 0 {
+		return []string{DigestSHA256}
+	}
+	return algorithms
+}
+
+// SetHedge hedges the request if it's idempotent and has no body,
+// a duplicate is sent if no response arrives within the delay of the
+// policy, the first response wins and the other requests are canceled
+func SetHedge(h *Hedge) RequestOption {
+	return func(o *requestOptions) {
+		o.hedge = h
+	}
+}
@@ -0,0 +1,140 @@
+package req
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimitError is returned by the fail-fast rate limiter
+// when no token is available
+type RateLimitError struct {
+	Key string
+	// RetryAfter the time until the next token is available
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("req: rate limit exceeded for %s, retry after %s", e.Key, e.RetryAfter)
+}
+
+// NewRateLimiter create the rate limiter allowing rate requests per second
+// with bursts of burst requests to every host
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{Rate: rate, Burst: burst}
+}
+
+// RateLimiter the token bucket rate limiter, every key (the host by
+// default) has its own bucket, it's safe for concurrent use
+type RateLimiter struct {
+	// Rate the tokens added per second, unlimited if not positive
+	Rate float64
+	// Burst the bucket size, 1 if not positive
+	Burst int
+	// Key returns the bucket key of the request, the URL host by default
+	Key func(req *http.Request) string
+	// FailFast returns a *RateLimitError instead of waiting for a token
+	FailFast bool
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (l *RateLimiter) burst() float64 {
+	if l.Burst < 1 {
+		return 1
+	}
+	return float64(l.Burst)
+}
+
+func (l *RateLimiter) key(req *http.Request) string {
+	if l.Key != nil {
+		return l.Key(req)
+	}
+	return req.URL.Host
+}
+
+// bucket returns the bucket of the key refilled up to now, l.mu is held
+func (l *RateLimiter) bucket(key string, now time.Time) *tokenBucket {
+	if l.buckets == nil {
+		l.buckets = make(map[string]*tokenBucket)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst(), last: now}
+		l.buckets[key] = b
+		return b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.Rate
+	if burst := l.burst(); b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	return b
+}
+
+// reserve takes a token of the key and returns the time to wait for it,
+// in fail-fast mode the token is only taken if it's available
+func (l *RateLimiter) reserve(key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key, time.Now())
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, nil
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	if l.FailFast {
+		return 0, &RateLimitError{Key: key, RetryAfter: wait}
+	}
+	b.tokens--
+	return wait, nil
+}
+
+// cancel returns the reserved token of the key
+func (l *RateLimiter) cancel(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key, time.Now())
+	if b.tokens++; b.tokens > l.burst() {
+		b.tokens = l.burst()
+	}
+}
+
+// Wait waits for a token of the request, the token is returned if the
+// context of the request is done first
+func (l *RateLimiter) Wait(req *http.Request) error {
+	if l.Rate <= 0 {
+		return nil
+	}
+
+	key := l.key(req)
+	wait, err := l.reserve(key)
+	if err != nil {
+		return err
+	}
+	if err := sleepContext(req.Context(), wait); err != nil {
+		l.cancel(key)
+		return err
+	}
+	return nil
+}
+
+func (l *RateLimiter) middleware(next Handler) Handler {
+	return func(req *http.Request) (*http.Response, error) {
+		if err := l.Wait(req); err != nil {
+			return nil, err
+		}
+		return next(req)
+	}
+}
@@ -0,0 +1,71 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRateLimiter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	other := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+
+	Convey("Test Rate Limiter Wait", t, func() {
+		r := New(SetRateLimiter(NewRateLimiter(20, 2)))
+
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.Get(context.Background(), ts.URL, nil)
+			}()
+		}
+		wg.Wait()
+		// the burst is free, the next 2 requests wait 50ms each
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 90*time.Millisecond)
+
+		// the hosts have their own buckets
+		start = time.Now()
+		_, err := r.Get(context.Background(), other, nil)
+		So(err, ShouldBeNil)
+		So(time.Since(start), ShouldBeLessThan, 40*time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		r = New(SetRateLimiter(NewRateLimiter(0.1, 1)))
+		r.Get(context.Background(), ts.URL, nil)
+		_, err = r.Get(ctx, ts.URL, nil)
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+	})
+
+	Convey("Test Rate Limiter Fail Fast", t, func() {
+		l := NewRateLimiter(1, 1)
+		l.FailFast = true
+		l.Key = func(req *http.Request) string {
+			return "all"
+		}
+		r := New(SetRateLimiter(l), SetRetry(NewRetry(3)))
+
+		_, err := r.Get(context.Background(), ts.URL, nil)
+		So(err, ShouldBeNil)
+
+		// the rate limit errors aren't retried
+		start := time.Now()
+		_, err = r.Get(context.Background(), other, nil)
+		So(time.Since(start), ShouldBeLessThan, 50*time.Millisecond)
+		var rle *RateLimitError
+		So(errors.As(err, &rle), ShouldBeTrue)
+		So(rle.Key, ShouldEqual, "all")
+		So(rle.RetryAfter, ShouldBeGreaterThan, 900*time.Millisecond)
+	})
+}
@@ -0,0 +1,391 @@
+// Package reqtest provides a record/replay round tripper for hermetic tests.
+package reqtest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// Mode the recorder mode
+type Mode int
+
+// Recorder modes
+const (
+	// ModeRecord sends the requests through the transport and records them
+	ModeRecord Mode = iota
+	// ModeReplay serves the requests from the cassette
+	ModeReplay
+)
+
+// ErrNoInteraction is returned in strict replay mode when no recorded
+// interaction matches the request
+var ErrNoInteraction = errors.New("reqtest: no matching interaction")
+
+const redacted = "[REDACTED]"
+
+// Cassette the recorded interactions
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction a recorded request/response pair
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request the recorded request
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// Response the recorded response
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+}
+
+// Body the recorded body, it's stored as a string if it's valid UTF-8
+// and base64 encoded otherwise
+type Body []byte
+
+// MarshalJSON implements json.Marshaler
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = Body(s)
+		return nil
+	}
+
+	var v struct {
+		Base64 string `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	buf, err := base64.StdEncoding.DecodeString(v.Base64)
+	if err != nil {
+		return err
+	}
+	*b = buf
+	return nil
+}
+
+// Matcher reports whether the request matches the recorded request,
+// body is the request body already read
+type Matcher func(req *http.Request, body []byte, rec *Request) bool
+
+// MatchMethod matches the request method
+func MatchMethod() Matcher {
+	return func(req *http.Request, _ []byte, rec *Request) bool {
+		return req.Method == rec.Method
+	}
+}
+
+// MatchURL matches the request URL
+func MatchURL() Matcher {
+	return func(req *http.Request, _ []byte, rec *Request) bool {
+		return req.URL.String() == rec.URL
+	}
+}
+
+// MatchBody matches the request body
+func MatchBody() Matcher {
+	return func(_ *http.Request, body []byte, rec *Request) bool {
+		return bytes.Equal(body, rec.Body)
+	}
+}
+
+// MatchHeaders matches the values of the request headers,
+// the redacted headers can't be matched
+func MatchHeaders(keys ...string) Matcher {
+	return func(req *http.Request, _ []byte, rec *Request) bool {
+		for _, k := range keys {
+			if fmt.Sprint(req.Header.Values(k)) != fmt.Sprint(rec.Header.Values(k)) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+type options struct {
+	transport     http.RoundTripper
+	matchers      []Matcher
+	redactHeaders []string
+	redact        func(*Interaction)
+	strict        bool
+}
+
+// Option recorder options
+type Option func(*options)
+
+// SetTransport specifies the transport making the real requests,
+// http.DefaultTransport by default
+func SetTransport(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = rt
+	}
+}
+
+// SetMatchers specifies the matchers of the replayed requests,
+// the method and URL are matched by default
+func SetMatchers(matchers ...Matcher) Option {
+	return func(o *options) {
+		o.matchers = matchers
+	}
+}
+
+// SetRedactHeaders specifies the headers redacted before the cassette is
+// written in addition to Authorization, Proxy-Authorization, Cookie and
+// Set-Cookie
+func SetRedactHeaders(keys ...string) Option {
+	return func(o *options) {
+		o.redactHeaders = append(o.redactHeaders, keys...)
+	}
+}
+
+// SetRedact specifies the function redacting the secrets of the
+// interaction before the cassette is written
+func SetRedact(fn func(*Interaction)) Option {
+	return func(o *options) {
+		o.redact = fn
+	}
+}
+
+// SetStrict fails the unmatched requests with ErrNoInteraction in replay
+// mode instead of sending them through the transport
+func SetStrict() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+var _ http.RoundTripper = &Recorder{}
+
+// Recorder the record/replay round tripper
+type Recorder struct {
+	path     string
+	mode     Mode
+	opts     options
+	mu       sync.Mutex
+	cassette *Cassette
+	used     map[*Interaction]bool
+}
+
+// New create a recorder of the cassette file, the cassette is loaded in
+// replay mode
+func New(path string, mode Mode, opt ...Option) (*Recorder, error) {
+	opts := options{
+		transport: http.DefaultTransport,
+		matchers:  []Matcher{MatchMethod(), MatchURL()},
+		redactHeaders: []string{
+			"Authorization",
+			"Proxy-Authorization",
+			"Cookie",
+			"Set-Cookie",
+		},
+	}
+	for _, o := range opt {
+		o(&opts)
+	}
+
+	r := &Recorder{
+		path:     path,
+		mode:     mode,
+		opts:     opts,
+		cassette: &Cassette{},
+		used:     make(map[*Interaction]bool),
+	}
+
+	if mode == ModeReplay {
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(buf, r.cassette); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Cassette returns the recorded interactions
+func (r *Recorder) Cassette() *Cassette {
+	return r.cassette
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.mode == ModeReplay {
+		if i := r.match(req, body); i != nil {
+			return i.Response.response(req), nil
+		}
+		if r.opts.strict {
+			return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL)
+		}
+		return r.send(req, body)
+	}
+
+	resp, err := r.send(req, body)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: req.Header.Clone(),
+			Body:   body,
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header.Clone(),
+			Body:       respBody,
+		},
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, i)
+	r.mu.Unlock()
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	return resp, nil
+}
+
+func (r *Recorder) send(req *http.Request, body []byte) (*http.Response, error) {
+	if body != nil {
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return r.opts.transport.RoundTrip(req)
+}
+
+// match finds the first unused matching interaction,
+// the used ones are replayed again if none is left
+func (r *Recorder) match(req *http.Request, body []byte) *Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var found *Interaction
+	for _, i := range r.cassette.Interactions {
+		if !r.matches(req, body, &i.Request) {
+			continue
+		}
+		if !r.used[i] {
+			r.used[i] = true
+			return i
+		}
+		if found == nil {
+			found = i
+		}
+	}
+	return found
+}
+
+func (r *Recorder) matches(req *http.Request, body []byte, rec *Request) bool {
+	for _, m := range r.opts.matchers {
+		if !m(req, body, rec) {
+			return false
+		}
+	}
+	return true
+}
+
+// Stop writes the redacted cassette in record mode
+func (r *Recorder) Stop() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, i := range r.cassette.Interactions {
+		for _, k := range r.opts.redactHeaders {
+			redactHeader(i.Request.Header, k)
+			redactHeader(i.Response.Header, k)
+		}
+		if fn := r.opts.redact; fn != nil {
+			fn(i)
+		}
+	}
+
+	buf, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, buf, 0644)
+}
+
+func redactHeader(h http.Header, key string) {
+	vs := h.Values(key)
+	for i := range vs {
+		vs[i] = redacted
+	}
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	defer req.Body.Close()
+
+	return ioutil.ReadAll(req.Body)
+}
+
+func (r *Response) response(req *http.Request) *http.Response {
+	header := r.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(r.StatusCode) + " " + http.StatusText(r.StatusCode),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,65 @@
+package reqtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LyricTian/req"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecorder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Token", "server-secret")
+		fmt.Fprintf(w, "%s %s", r.Method, body)
+	}))
+
+	dir, err := ioutil.TempDir("", "reqtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.json")
+
+	Convey("Test Record and Replay", t, func() {
+		rec, err := New(path, ModeRecord, SetRedactHeaders("X-Token"))
+		So(err, ShouldBeNil)
+		r := req.New(req.SetRoundTripper(rec))
+
+		resp, err := r.Post(context.Background(), ts.URL+"/foo", strings.NewReader("bar"),
+			req.SetBasicAuth("user", "secret"))
+		So(err, ShouldBeNil)
+		body, err := resp.String()
+		So(err, ShouldBeNil)
+		So(body, ShouldEqual, "POST bar")
+		So(rec.Stop(), ShouldBeNil)
+
+		buf, err := ioutil.ReadFile(path)
+		So(err, ShouldBeNil)
+		So(string(buf), ShouldNotContainSubstring, "secret")
+		ts.Close()
+
+		rec, err = New(path, ModeReplay, SetStrict(), SetMatchers(MatchMethod(), MatchURL(), MatchBody()))
+		So(err, ShouldBeNil)
+		r = req.New(req.SetRoundTripper(rec))
+
+		resp, err = r.Post(context.Background(), ts.URL+"/foo", strings.NewReader("bar"))
+		So(err, ShouldBeNil)
+		body, err = resp.String()
+		So(err, ShouldBeNil)
+		So(body, ShouldEqual, "POST bar")
+		So(resp.Response().Header.Get("X-Token"), ShouldEqual, redacted)
+
+		_, err = r.Post(context.Background(), ts.URL+"/foo", strings.NewReader("baz"))
+		So(errors.Is(err, ErrNoInteraction), ShouldBeTrue)
+	})
+}
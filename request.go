@@ -3,12 +3,12 @@ package req
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 var _ Requester = &request{}
@@ -25,6 +25,9 @@ type Requester interface {
 	Put(ctx context.Context, urlStr string, body io.Reader, opts ...RequestOption) (Responser, error)
 	PutJSON(ctx context.Context, urlStr string, body interface{}, opts ...RequestOption) (Responser, error)
 	PutForm(ctx context.Context, urlStr string, body url.Values, opts ...RequestOption) (Responser, error)
+	PostMultipart(ctx context.Context, urlStr string, fields url.Values, files []*FormFile, opts ...RequestOption) (Responser, error)
+	PutMultipart(ctx context.Context, urlStr string, fields url.Values, files []*FormFile, opts ...RequestOption) (Responser, error)
+	Download(ctx context.Context, urlStr, path string, opts ...RequestOption) error
 	Do(ctx context.Context, urlStr, method string, body io.Reader, opts ...RequestOption) (Responser, error)
 }
 
@@ -53,11 +56,22 @@ func New(opt ...Option) Requester {
 	for _, o := range opt {
 		o(&opts)
 	}
+	if opts.cache != nil && opts.cacheMaxEntrySize > 0 {
+		opts.cache.maxEntrySize = opts.cacheMaxEntrySize
+	}
+
+	var tr http.RoundTripper
+	if opts.roundTripper != nil {
+		tr = opts.roundTripper
+	} else if opts.transport != nil {
+		tr = opts.transport
+	}
 
 	req := &request{
-		opts: opts,
+		opts:    opts,
+		digests: newDigestSessions(),
 		cli: &http.Client{
-			Transport:     opts.transport,
+			Transport:     tr,
 			CheckRedirect: opts.checkRedirect,
 			Jar:           opts.cookieJar,
 			Timeout:       opts.timeout,
@@ -68,8 +82,9 @@ func New(opt ...Option) Requester {
 }
 
 type request struct {
-	opts options
-	cli  *http.Client
+	opts    options
+	cli     *http.Client
+	digests *digestSessions
 }
 
 func (r *request) parseQueryParam(urlStr string, param url.Values) string {
@@ -83,7 +98,7 @@ func (r *request) parseQueryParam(urlStr string, param url.Values) string {
 	return urlStr
 }
 
-func (r *request) fillRequest(req *http.Request, opts ...RequestOption) (*http.Request, error) {
+func (r *request) fillRequest(req *http.Request, opts ...RequestOption) (*http.Request, *requestOptions, error) {
 	if req.Header == nil {
 		req.Header = make(http.Header)
 	}
@@ -93,17 +108,23 @@ func (r *request) fillRequest(req *http.Request, opts ...RequestOption) (*http.R
 	}
 
 	ro := &requestOptions{
-		request: req,
+		request:       req,
+		retry:         r.opts.retry,
+		status:        r.opts.status,
+		trace:         r.opts.trace,
+		signers:       r.opts.signers,
+		contentDigest: r.opts.contentDigest,
 	}
 	for _, opt := range opts {
 		opt(ro)
 	}
 
 	if fn := ro.handle; fn != nil {
-		return fn(req)
+		req, err := fn(req)
+		return req, ro, err
 	}
 
-	return req, nil
+	return req, ro, nil
 }
 
 func (r *request) doForm(ctx context.Context, urlStr, method string, body url.Values, opts ...RequestOption) (Responser, error) {
@@ -122,22 +143,64 @@ func (r *request) doForm(ctx context.Context, urlStr, method string, body url.Va
 }
 
 func (r *request) doJSON(ctx context.Context, urlStr, method string, body interface{}, opts ...RequestOption) (Responser, error) {
-	buf := new(bytes.Buffer)
-	err := json.NewEncoder(buf).Encode(body)
+	return doBody(ctx, r, urlStr, method, MIMEApplicationJSONCharsetUTF8, body, opts...)
+}
+
+func (r *request) send(req *http.Request) (*http.Response, error) {
+	return r.cli.Do(req)
+}
+
+func (r *request) doMultipart(ctx context.Context, urlStr, method string, fields url.Values, files []*FormFile, opts ...RequestOption) (Responser, error) {
+	body, err := newMultipartBody(fields, files)
 	if err != nil {
 		return nil, err
 	}
 
 	var ro []RequestOption
-	ro = append(ro, SetContentType(MIMEApplicationJSONCharsetUTF8))
+	ro = append(ro, setMultipartBody(body))
 	if len(opts) > 0 {
 		ro = append(ro, opts...)
 	}
-	return r.Do(ctx, urlStr, method, buf, ro...)
+	return r.Do(ctx, urlStr, method, body.reader(), ro...)
 }
 
-func (r *request) httpDo(ctx context.Context, req *http.Request, f func(*http.Response, error) error) error {
-	return f(r.cli.Do(req))
+func (r *request) httpDo(ctx context.Context, req *http.Request, ro *requestOptions, f func(*http.Response, error) error) error {
+	h := Handler(r.send)
+	if har := r.opts.har; har != nil {
+		// every attempt sent to the server is recorded
+		h = newHARMiddleware(har)(h)
+	}
+	if b := r.opts.breaker; b != nil {
+		// the breaker counts only the attempts sent to the host
+		h = b.middleware(h)
+	}
+	signers := ro.signers
+	if len(ro.contentDigest) > 0 {
+		// the digest is signed by the signers
+		signers = append([]Signer{contentDigester(ro.contentDigest)}, signers...)
+	}
+	if len(signers) > 0 {
+		h = signMiddleware(signers)(h)
+	}
+	if t := r.opts.throttler; t != nil {
+		h = t.middleware(h)
+	}
+	if l := r.opts.rateLimiter; l != nil {
+		h = l.middleware(h)
+	}
+	if ro.digest != nil {
+		h = r.digests.middleware(ro.digest)(h)
+	}
+	if ro.endpoint != nil {
+		h = r.opts.balancer.middleware(ro.endpoint, ro.target)(h)
+	}
+	if ro.hedge != nil {
+		h = ro.hedge.middleware(h)
+	}
+	h = retryMiddleware(ro.retry)(h)
+	h = chainMiddleware(h, ro.middlewares...)
+	h = chainMiddleware(h, r.opts.middlewares...)
+	return f(h(req))
 }
 
 func (r *request) Head(ctx context.Context, urlStr string, queryParam url.Values, opts ...RequestOption) (Responser, error) {
@@ -180,33 +243,86 @@ func (r *request) PutForm(ctx context.Context, urlStr string, body url.Values, o
 	return r.doForm(ctx, urlStr, http.MethodPut, body, opts...)
 }
 
+func (r *request) PostMultipart(ctx context.Context, urlStr string, fields url.Values, files []*FormFile, opts ...RequestOption) (Responser, error) {
+	return r.doMultipart(ctx, urlStr, http.MethodPost, fields, files, opts...)
+}
+
+func (r *request) PutMultipart(ctx context.Context, urlStr string, fields url.Values, files []*FormFile, opts ...RequestOption) (Responser, error) {
+	return r.doMultipart(ctx, urlStr, http.MethodPut, fields, files, opts...)
+}
+
+func (r *request) Download(ctx context.Context, urlStr, path string, opts ...RequestOption) error {
+	return r.download(ctx, urlStr, path, true, opts...)
+}
+
 func (r *request) Do(ctx context.Context, urlStr, method string, body io.Reader, opts ...RequestOption) (Responser, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
-	url := RequestURL(r.opts.baseURL, urlStr)
+	base := r.opts.baseURL
+	var ep *endpoint
+	if b := r.opts.balancer; b != nil && !isAbsoluteURL(urlStr) {
+		if ep = b.pick(urlStr, nil); ep != nil {
+			base = ep.base
+		}
+	}
+	url := RequestURL(base, urlStr)
 	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err = r.fillRequest(req, opts...)
+	req, ro, err := r.fillRequest(req, opts...)
 	if err != nil {
 		return nil, err
 	}
+	ro.endpoint, ro.target = ep, urlStr
+
+	var t *tracer
+	if ro.trace {
+		t = newTracer()
+		req = withTracer(req, t)
+	}
 
-	var resp Responser
-	err = r.httpDo(ctx, req, func(res *http.Response, err error) error {
+	var (
+		resp       Responser
+		statusCode int
+	)
+	start := time.Now()
+	err = r.httpDo(ctx, req, ro, func(res *http.Response, err error) error {
 		if err != nil {
 			return err
 		}
-		resp = newResponse(res)
+		statusCode = res.StatusCode
+		if err := checkStatus(ro.status, res); err != nil {
+			return err
+		}
+		if t != nil {
+			res.Body = &traceBody{ReadCloser: res.Body, t: t}
+		}
+		resp = newResponse(res, r.opts.codecs, t)
 		return nil
 	})
+	r.record(req, ro, statusCode, err, time.Since(start))
 	if err != nil {
 		return nil, err
 	}
 
 	return resp, nil
 }
+
+func (r *request) record(req *http.Request, ro *requestOptions, statusCode int, err error, d time.Duration) {
+	if r.opts.metrics == nil {
+		return
+	}
+
+	r.opts.metrics.Record(&Metric{
+		Method:     req.Method,
+		Host:       req.URL.Host,
+		Route:      ro.route,
+		StatusCode: statusCode,
+		Err:        err,
+		Duration:   d,
+	})
+}
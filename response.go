@@ -2,6 +2,7 @@ package req
 
 import (
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net/http"
 )
@@ -15,15 +16,26 @@ type Responser interface {
 	String() (string, error)
 	Bytes() ([]byte, error)
 	JSON(v interface{}) error
+	Decode(v interface{}) error
+	CopyTo(w io.Writer) (int64, error)
+	SaveTo(path string) (int64, error)
+	FromCache() bool
+	Timings() Timings
 	Close()
 }
 
-func newResponse(resp *http.Response) *response {
-	return &response{resp}
+func newResponse(resp *http.Response, codecs codecRegistry, t *tracer) *response {
+	return &response{
+		resp:   resp,
+		codecs: codecs,
+		tracer: t,
+	}
 }
 
 type response struct {
-	resp *http.Response
+	resp   *http.Response
+	codecs codecRegistry
+	tracer *tracer
 }
 
 func (r *response) StatusCode() int {
@@ -55,7 +67,52 @@ func (r *response) Bytes() ([]byte, error) {
 func (r *response) JSON(v interface{}) error {
 	defer r.resp.Body.Close()
 
-	return json.NewDecoder(r.resp.Body).Decode(v)
+	if err := json.NewDecoder(r.resp.Body).Decode(v); err != nil {
+		return err
+	}
+	if !verifyingDigest(r.resp) {
+		return nil
+	}
+	// the rest of the body is read to verify its digest
+	_, err := io.Copy(ioutil.Discard, r.resp.Body)
+	return err
+}
+
+func (r *response) Decode(v interface{}) error {
+	codec, err := r.codecs.lookup(r.resp.Header.Get(HeaderContentType))
+	if err != nil {
+		r.Close()
+		return err
+	}
+
+	buf, err := r.Bytes()
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(buf, v)
+}
+
+func (r *response) CopyTo(w io.Writer) (int64, error) {
+	defer r.resp.Body.Close()
+
+	return io.Copy(w, r.resp.Body)
+}
+
+func (r *response) SaveTo(path string) (int64, error) {
+	defer r.resp.Body.Close()
+
+	return saveFile(path, r.resp.Body)
+}
+
+func (r *response) FromCache() bool {
+	return fromCache(r.resp)
+}
+
+func (r *response) Timings() Timings {
+	if r.tracer == nil {
+		return Timings{}
+	}
+	return r.tracer.timings()
 }
 
 func (r *response) Close() {
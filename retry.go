@@ -0,0 +1,244 @@
+package req
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Retry retry policy options
+type Retry struct {
+	// Count the maximum number of retries after the first attempt,
+	// zero disables retrying
+	Count int
+	// WaitMin the backoff before the first retry, doubled on every
+	// following retry (default 100ms)
+	WaitMin time.Duration
+	// WaitMax the upper bound of the backoff (default 5s), the response
+	// asking to retry after a longer time with the Retry-After header
+	// isn't retried
+	WaitMax time.Duration
+	// StatusCodes the response status codes to retry on
+	// (default 408, 429, 500, 502, 503 and 504)
+	StatusCodes []int
+	// Methods the request methods allowed to be retried
+	// (default the idempotent methods)
+	Methods []string
+	// RetryIf if not nil, decides whether the attempt should be retried
+	// instead of StatusCodes and the transport error check
+	RetryIf func(resp *http.Response, err error) bool
+}
+
+// NewRetry create a retry policy with the default options
+func NewRetry(count int) *Retry {
+	return &Retry{
+		Count: count,
+	}
+}
+
+var (
+	defaultRetryWaitMin     = 100 * time.Millisecond
+	defaultRetryWaitMax     = 5 * time.Second
+	defaultRetryStatusCodes = []int{
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+	idempotentMethods = []string{
+		http.MethodGet,
+		http.MethodHead,
+		http.MethodOptions,
+		http.MethodTrace,
+		http.MethodPut,
+		http.MethodDelete,
+	}
+)
+
+func (rt *Retry) allowMethod(method string) bool {
+	methods := rt.Methods
+	if methods == nil {
+		methods = idempotentMethods
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (rt *Retry) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if !rt.allowMethod(req.Method) || !canRewindBody(req) {
+		return false
+	}
+
+	if err != nil {
+		var rle *RateLimitError
+		if req.Context().Err() != nil || errors.Is(err, ErrCircuitOpen) || errors.As(err, &rle) {
+			return false
+		}
+	}
+
+	if fn := rt.RetryIf; fn != nil {
+		return fn(resp, err)
+	}
+
+	if err != nil {
+		return true
+	}
+
+	codes := rt.StatusCodes
+	if codes == nil {
+		codes = defaultRetryStatusCodes
+	}
+	for _, code := range codes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the wait before the given retry (starting from zero),
+// the Retry-After response header takes precedence when present,
+// ok is false if it's longer than WaitMax
+func (rt *Retry) backoff(attempt int, resp *http.Response) (wait time.Duration, ok bool) {
+	min, max := rt.WaitMin, rt.WaitMax
+	if min <= 0 {
+		min = defaultRetryWaitMin
+	}
+	if max <= 0 {
+		max = defaultRetryWaitMax
+	}
+	if max < min {
+		max = min
+	}
+
+	if resp != nil {
+		if d, ok := parseRetryAfter(resp.Header.Get(HeaderRetryAfter)); ok {
+			return d, d <= max
+		}
+	}
+
+	wait = min
+	for i := 0; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+
+	// equal jitter: keep half of the wait and randomize the other half
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(wait-half)+1)), true
+}
+
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if sec, err := strconv.Atoi(v); err == nil {
+		if sec < 0 {
+			return 0, false
+		}
+		return time.Duration(sec) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+func canRewindBody(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// errNotRewindable is returned when the request body can't be sent again
+var errNotRewindable = errors.New("req: the request body can't be rewound")
+
+// rewindRequest returns a copy of the request with a fresh body
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	nreq := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return nreq, nil
+	}
+	if req.GetBody == nil {
+		return nil, errNotRewindable
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	nreq.Body = body
+	return nreq, nil
+}
+
+func drainBody(body io.ReadCloser) {
+	// read a little to allow the connection to be reused
+	io.CopyN(ioutil.Discard, body, 4<<10)
+	body.Close()
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func retryMiddleware(rt *Retry) Middleware {
+	return func(next Handler) Handler {
+		if rt == nil || rt.Count <= 0 {
+			return next
+		}
+
+		return func(req *http.Request) (*http.Response, error) {
+			for attempt := 0; ; attempt++ {
+				resp, err := next(req)
+				if attempt >= rt.Count || !rt.shouldRetry(req, resp, err) {
+					return resp, err
+				}
+
+				wait, ok := rt.backoff(attempt, resp)
+				if !ok {
+					// the server asks to wait longer than allowed
+					return resp, err
+				}
+				if resp != nil {
+					drainBody(resp.Body)
+				}
+
+				if err := sleepContext(req.Context(), wait); err != nil {
+					return nil, err
+				}
+
+				req, err = rewindRequest(req)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRetry(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&count, 1)%3 != 0 {
+			w.Header().Set(HeaderRetryAfter, "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "%s", body)
+	}))
+	defer ts.Close()
+
+	Convey("Test Retry Request", t, func() {
+		r := New(SetRetry(&Retry{Count: 2, WaitMin: time.Millisecond}))
+
+		atomic.StoreInt32(&count, 0)
+		resp, err := r.PutJSON(context.Background(), ts.URL, map[string]string{"foo": "bar"})
+		So(err, ShouldBeNil)
+		So(resp.StatusCode(), ShouldEqual, 200)
+		body, err := resp.String()
+		So(err, ShouldBeNil)
+		So(body, ShouldEqual, "{\"foo\":\"bar\"}\n")
+		So(atomic.LoadInt32(&count), ShouldEqual, 3)
+
+		atomic.StoreInt32(&count, 0)
+		resp, err = r.PostJSON(context.Background(), ts.URL, map[string]string{"foo": "bar"})
+		So(err, ShouldBeNil)
+		So(resp.StatusCode(), ShouldEqual, http.StatusServiceUnavailable)
+		resp.Close()
+		So(atomic.LoadInt32(&count), ShouldEqual, 1)
+
+		atomic.StoreInt32(&count, 0)
+		resp, err = r.Get(context.Background(), ts.URL, nil, SetRequestRetry(nil))
+		So(err, ShouldBeNil)
+		So(resp.StatusCode(), ShouldEqual, http.StatusServiceUnavailable)
+		resp.Close()
+		So(atomic.LoadInt32(&count), ShouldEqual, 1)
+	})
+
+	Convey("Test Retry Backoff", t, func() {
+		rt := &Retry{WaitMin: time.Millisecond, WaitMax: time.Second}
+		resp := &http.Response{Header: make(http.Header)}
+		resp.Header.Set(HeaderRetryAfter, "0")
+		wait, ok := rt.backoff(0, resp)
+		So(wait, ShouldEqual, 0)
+		So(ok, ShouldBeTrue)
+
+		// the Retry-After longer than WaitMax isn't waited
+		resp.Header.Set(HeaderRetryAfter, "86400")
+		_, ok = rt.backoff(0, resp)
+		So(ok, ShouldBeFalse)
+
+		resp.Header.Del(HeaderRetryAfter)
+		wait, ok = rt.backoff(0, resp)
+		So(wait, ShouldBeLessThanOrEqualTo, time.Millisecond)
+		So(ok, ShouldBeTrue)
+
+		var hits int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			w.Header().Set(HeaderRetryAfter, "3600")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer ts.Close()
+
+		// the response is returned at once
+		r := New(SetRetry(&Retry{Count: 2, WaitMax: time.Second}))
+		start := time.Now()
+		res, err := r.Get(context.Background(), ts.URL, nil)
+		So(err, ShouldBeNil)
+		So(res.StatusCode(), ShouldEqual, http.StatusServiceUnavailable)
+		res.Close()
+		So(atomic.LoadInt32(&hits), ShouldEqual, 1)
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+	})
+}
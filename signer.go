@@ -0,0 +1,34 @@
+package req
+
+import (
+	"net/http"
+)
+
+// Signer signs the request, it's called before every attempt
+// once the request is complete, the headers can be modified
+type Signer interface {
+	Sign(req *http.Request) error
+}
+
+// SignerFunc the function adapter of Signer
+type SignerFunc func(req *http.Request) error
+
+// Sign call f(req)
+func (f SignerFunc) Sign(req *http.Request) error {
+	return f(req)
+}
+
+// signMiddleware signs a copy of the request with the signers in order
+func signMiddleware(signers []Signer) Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			for _, s := range signers {
+				if err := s.Sign(req); err != nil {
+					return nil, err
+				}
+			}
+			return next(req)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package req
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SigV4 headers
+const (
+	HeaderXAmzDate          = "X-Amz-Date"
+	HeaderXAmzContentSha256 = "X-Amz-Content-Sha256"
+	HeaderXAmzSecurityToken = "X-Amz-Security-Token"
+)
+
+const (
+	sigV4Algorithm       = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat      = "20060102T150405Z"
+	sigV4UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// sigV4IgnoredHeaders the headers changed by proxies or the transport
+var sigV4IgnoredHeaders = map[string]bool{
+	"authorization":     true,
+	"user-agent":        true,
+	"x-amzn-trace-id":   true,
+	"expect":            true,
+	"connection":        true,
+	"content-length":    true,
+	"transfer-encoding": true,
+}
+
+var _ Signer = &SigV4{}
+
+// NewSigV4 create the AWS Signature Version 4 signer,
+// the session token of temporary credentials can be empty
+func NewSigV4(accessKey, secretKey, sessionToken, region, service string) *SigV4 {
+	return &SigV4{
+		AccessKey:    accessKey,
+		SecretKey:    secretKey,
+		SessionToken: sessionToken,
+		Region:       region,
+		Service:      service,
+	}
+}
+
+// SigV4 the AWS Signature Version 4 signer, the payload is hashed if the
+// body can be read again and sent as UNSIGNED-PAYLOAD otherwise
+type SigV4 struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Region       string
+	Service      string
+	// UnsignedPayload doesn't hash the payload, it's supported by S3
+	UnsignedPayload bool
+
+	now func() time.Time
+}
+
+func (s *SigV4) time() time.Time {
+	if s.now != nil {
+		return s.now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+// Sign adds the Authorization, X-Amz-Date and X-Amz-Content-Sha256 headers
+func (s *SigV4) Sign(req *http.Request) error {
+	t := s.time()
+
+	payload := req.Header.Get(HeaderXAmzContentSha256)
+	if payload == "" {
+		var err error
+		if payload, err = s.payloadHash(req); err != nil {
+			return err
+		}
+	}
+
+	req.Header.Del(HeaderAuthorization)
+	req.Header.Set(HeaderXAmzDate, t.Format(sigV4TimeFormat))
+	req.Header.Set(HeaderXAmzContentSha256, payload)
+	if s.SessionToken != "" {
+		req.Header.Set(HeaderXAmzSecurityToken, s.SessionToken)
+	}
+
+	headers, signed := s.canonicalHeaders(req)
+	cr := strings.Join([]string{
+		req.Method,
+		s.canonicalPath(req.URL),
+		sigV4Query(req.URL.Query()),
+		headers,
+		signed,
+		payload,
+	}, "\n")
+
+	scope := s.scope(t)
+	req.Header.Set(HeaderAuthorization, fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, s.AccessKey, scope, signed, s.signature(t, scope, cr)))
+	return nil
+}
+
+// Presign returns the presigned URL of the request valid for expires,
+// only the host header is signed
+func (s *SigV4) Presign(method, urlStr string, expires time.Duration) (string, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "", err
+	}
+	t := s.time()
+	scope := s.scope(t)
+
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", s.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", t.Format(sigV4TimeFormat))
+	query.Set("X-Amz-Expires", fmt.Sprint(int64(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if s.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	payload := sigV4UnsignedPayload
+	if s.Service != "s3" {
+		payload = sigV4Hash(nil)
+	}
+	cr := strings.Join([]string{
+		method,
+		s.canonicalPath(u),
+		sigV4Query(query),
+		"host:" + u.Host + "\n",
+		"host",
+		payload,
+	}, "\n")
+
+	u.RawQuery = sigV4Query(query) + "&X-Amz-Signature=" + s.signature(t, scope, cr)
+	return u.String(), nil
+}
+
+func (s *SigV4) payloadHash(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return sigV4Hash(nil), nil
+	}
+	if s.UnsignedPayload || req.GetBody == nil {
+		return sigV4UnsignedPayload, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (s *SigV4) scope(t time.Time) string {
+	return strings.Join([]string{t.Format("20060102"), s.Region, s.Service, "aws4_request"}, "/")
+}
+
+func (s *SigV4) signature(t time.Time, scope, canonicalRequest string) string {
+	sts := strings.Join([]string{
+		sigV4Algorithm,
+		t.Format(sigV4TimeFormat),
+		scope,
+		sigV4Hash([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, v := range []string{t.Format("20060102"), s.Region, s.Service, "aws4_request"} {
+		key = sigV4HMAC(key, v)
+	}
+	return hex.EncodeToString(sigV4HMAC(key, sts))
+}
+
+// canonicalPath the URI encoded path, it's encoded twice except for S3
+func (s *SigV4) canonicalPath(u *url.URL) string {
+	path := u.EscapedPath()
+	if s.Service == "s3" {
+		path = u.Path
+	}
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, v := range segments {
+		segments[i] = sigV4Escape(v)
+	}
+	return strings.Join(segments, "/")
+}
+
+func (s *SigV4) canonicalHeaders(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values := map[string][]string{"host": {host}}
+	for k, vs := range req.Header {
+		k = strings.ToLower(k)
+		if !sigV4IgnoredHeaders[k] {
+			values[k] = append(values[k], vs...)
+		}
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		vs := make([]string, len(values[k]))
+		for i, v := range values[k] {
+			vs[i] = strings.Join(strings.Fields(v), " ")
+		}
+		b.WriteString(k + ":" + strings.Join(vs, ",") + "\n")
+	}
+	return b.String(), strings.Join(keys, ";")
+}
+
+// sigV4Query the URI encoded query sorted by the key and value
+func sigV4Query(query url.Values) string {
+	var pairs [][2]string
+	for k, vs := range query {
+		for _, v := range vs {
+			pairs = append(pairs, [2]string{sigV4Escape(k), sigV4Escape(v)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+
+	list := make([]string, len(pairs))
+	for i, p := range pairs {
+		list[i] = p[0] + "=" + p[1]
+	}
+	return strings.Join(list, "&")
+}
+
+// sigV4Escape encodes all the characters except the unreserved ones
+func sigV4Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sigV4Hash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func sigV4HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,244 @@
+package req
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate limit headers
+const (
+	HeaderXRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderXRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderXRateLimitReset     = "X-RateLimit-Reset"
+	HeaderRateLimit           = "RateLimit"
+	HeaderRateLimitPolicy     = "RateLimit-Policy"
+	HeaderRateLimitLimit      = "RateLimit-Limit"
+	HeaderRateLimitRemaining  = "RateLimit-Remaining"
+	HeaderRateLimitReset      = "RateLimit-Reset"
+)
+
+// RateLimitState the rate limit announced by a host
+type RateLimitState struct {
+	// Limit the requests allowed in the window, 0 if unknown
+	Limit int `json:"limit"`
+	// Remaining the requests left in the window, decremented
+	// by the requests sent since the last response
+	Remaining int `json:"remaining"`
+	// Reset the end of the window
+	Reset time.Time `json:"reset"`
+	// Updated the time of the last response announcing the limit
+	Updated time.Time `json:"updated"`
+}
+
+// NewThrottler create the throttler delaying the requests to a host
+// once its announced budget is exhausted
+func NewThrottler() *Throttler {
+	return &Throttler{MaxDelay: time.Minute}
+}
+
+// Throttler tracks the rate limits announced by the X-RateLimit-*,
+// RateLimit-* and RateLimit/RateLimit-Policy headers and the 429
+// Retry-After of every host and delays the requests accordingly,
+// it's safe for concurrent use
+type Throttler struct {
+	// Key returns the state key of the request, the URL host by default
+	Key func(req *http.Request) string
+	// Reserve the requests kept in reserve, the requests wait for the
+	// reset once the remaining budget falls to the reserve
+	Reserve int
+	// Pace spreads the remaining budget evenly over the window
+	Pace bool
+	// MaxDelay the maximum delay of a request, unlimited if zero
+	MaxDelay time.Duration
+
+	mu     sync.Mutex
+	states map[string]*RateLimitState
+}
+
+func (t *Throttler) key(req *http.Request) string {
+	if t.Key != nil {
+		return t.Key(req)
+	}
+	return req.URL.Host
+}
+
+// State returns the rate limit state of the key
+func (t *Throttler) State(key string) (RateLimitState, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.states[key]
+	if !ok {
+		return RateLimitState{}, false
+	}
+	return *s, true
+}
+
+// States returns the rate limit states keyed by host
+func (t *Throttler) States() map[string]RateLimitState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	m := make(map[string]RateLimitState, len(t.states))
+	for k, s := range t.states {
+		m[k] = *s
+	}
+	return m
+}
+
+// String returns the states as JSON, so the throttler is an expvar.Var
+func (t *Throttler) String() string {
+	b, err := json.Marshal(t.States())
+	if err != nil {
+		return "null"
+	}
+	return string(b)
+}
+
+// Publish exports the states as the expvar variable name,
+// it panics if the name is already registered
+func (t *Throttler) Publish(name string) {
+	expvar.Publish(name, t)
+}
+
+// delay returns the delay of the next request of the key
+// and takes its share of the budget
+func (t *Throttler) delay(key string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.states[key]
+	if !ok || !now.Before(s.Reset) {
+		return 0
+	}
+
+	var d time.Duration
+	if s.Remaining <= t.Reserve {
+		d = s.Reset.Sub(now)
+	} else if t.Pace {
+		d = s.Reset.Sub(now) / time.Duration(s.Remaining-t.Reserve+1)
+	}
+	s.Remaining--
+
+	if t.MaxDelay > 0 && d > t.MaxDelay {
+		d = t.MaxDelay
+	}
+	return d
+}
+
+// update records the rate limit announced by the response
+func (t *Throttler) update(key string, resp *http.Response, now time.Time) {
+	limit, remaining, reset, ok := parseRateLimit(resp.Header, now)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if d, found := parseRetryAfter(resp.Header.Get(HeaderRetryAfter)); found {
+			remaining, reset, ok = 0, now.Add(d), true
+		}
+	}
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.states == nil {
+		t.states = make(map[string]*RateLimitState)
+	}
+	s, found := t.states[key]
+	if !found {
+		s = &RateLimitState{}
+		t.states[key] = s
+	}
+	if limit > 0 {
+		s.Limit = limit
+	}
+	s.Remaining = remaining
+	s.Reset = reset
+	s.Updated = now
+}
+
+// parseRateLimit parses the remaining budget and the reset time of the
+// rate limit headers, ok is false if the response doesn't announce them
+func parseRateLimit(h http.Header, now time.Time) (limit, remaining int, reset time.Time, ok bool) {
+	atoi := func(v string) int {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return -1
+		}
+		return n
+	}
+	resetAt := func(v string) time.Time {
+		sec := atoi(v)
+		if sec < 0 {
+			return time.Time{}
+		}
+		// the large values are the Unix times of the reset
+		if sec > 1e9 {
+			return time.Unix(int64(sec), 0)
+		}
+		return now.Add(time.Duration(sec) * time.Second)
+	}
+
+	limit, remaining = -1, -1
+	if v := h.Get(HeaderRateLimit); v != "" {
+		// RateLimit: "default";r=50;t=30 or limit=100, remaining=50, reset=30
+		for _, item := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ';' }) {
+			kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch strings.ToLower(kv[0]) {
+			case "r", "remaining":
+				remaining = atoi(kv[1])
+			case "t", "reset":
+				reset = resetAt(kv[1])
+			case "limit":
+				limit = atoi(kv[1])
+			}
+		}
+		if v := h.Get(HeaderRateLimitPolicy); v != "" {
+			for _, item := range strings.Split(v, ";") {
+				if kv := strings.SplitN(strings.TrimSpace(item), "=", 2); len(kv) == 2 && kv[0] == "q" {
+					limit = atoi(kv[1])
+				}
+			}
+		}
+	} else {
+		for _, keys := range [][3]string{
+			{HeaderXRateLimitLimit, HeaderXRateLimitRemaining, HeaderXRateLimitReset},
+			{HeaderRateLimitLimit, HeaderRateLimitRemaining, HeaderRateLimitReset},
+		} {
+			if v := h.Get(keys[1]); v != "" {
+				limit = atoi(h.Get(keys[0]))
+				remaining = atoi(v)
+				reset = resetAt(h.Get(keys[2]))
+				break
+			}
+		}
+	}
+
+	if remaining < 0 || reset.IsZero() {
+		return 0, 0, time.Time{}, false
+	}
+	return limit, remaining, reset, true
+}
+
+func (t *Throttler) middleware(next Handler) Handler {
+	return func(req *http.Request) (*http.Response, error) {
+		key := t.key(req)
+		if err := sleepContext(req.Context(), t.delay(key, time.Now())); err != nil {
+			return nil, err
+		}
+
+		resp, err := next(req)
+		if err == nil {
+			t.update(key, resp, time.Now())
+		}
+		return resp, err
+	}
+}
@@ -0,0 +1,90 @@
+package req
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestThrottler(t *testing.T) {
+	Convey("Test Parse Rate Limit", t, func() {
+		now := time.Unix(1700000000, 0)
+		for _, c := range []struct {
+			header    http.Header
+			limit     int
+			remaining int
+			reset     time.Time
+		}{
+			{http.Header{"X-Ratelimit-Limit": {"60"}, "X-Ratelimit-Remaining": {"10"}, "X-Ratelimit-Reset": {"1700000030"}},
+				60, 10, now.Add(30 * time.Second)},
+			{http.Header{"Ratelimit-Limit": {"100"}, "Ratelimit-Remaining": {"5"}, "Ratelimit-Reset": {"20"}},
+				100, 5, now.Add(20 * time.Second)},
+			{http.Header{"Ratelimit": {"limit=10, remaining=3, reset=5"}},
+				10, 3, now.Add(5 * time.Second)},
+			{http.Header{"Ratelimit": {`"default";r=50;t=30`}, "Ratelimit-Policy": {`"default";q=100;w=60`}},
+				100, 50, now.Add(30 * time.Second)},
+		} {
+			limit, remaining, reset, ok := parseRateLimit(c.header, now)
+			So(ok, ShouldBeTrue)
+			So(limit, ShouldEqual, c.limit)
+			So(remaining, ShouldEqual, c.remaining)
+			So(reset, ShouldEqual, c.reset)
+		}
+
+		_, _, _, ok := parseRateLimit(http.Header{"X-Ratelimit-Limit": {"60"}}, now)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Test Throttler", t, func() {
+		remaining := "2"
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/429" {
+				w.Header().Set(HeaderRetryAfter, "10")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Header().Set(HeaderXRateLimitLimit, "3")
+			w.Header().Set(HeaderXRateLimitRemaining, remaining)
+			w.Header().Set(HeaderXRateLimitReset, "60")
+		}))
+		defer ts.Close()
+		u, _ := url.Parse(ts.URL)
+
+		th := NewThrottler()
+		th.MaxDelay = 100 * time.Millisecond
+		r := New(SetThrottler(th))
+
+		_, err := r.Get(context.Background(), ts.URL, nil)
+		So(err, ShouldBeNil)
+		state, ok := th.State(u.Host)
+		So(ok, ShouldBeTrue)
+		So(state.Limit, ShouldEqual, 3)
+		So(state.Remaining, ShouldEqual, 2)
+
+		// the budget is left
+		start := time.Now()
+		remaining = "0"
+		_, err = r.Get(context.Background(), ts.URL, nil)
+		So(err, ShouldBeNil)
+		So(time.Since(start), ShouldBeLessThan, 50*time.Millisecond)
+
+		// the budget is exhausted, the request waits for the reset
+		start = time.Now()
+		_, err = r.Get(context.Background(), ts.URL, nil)
+		So(err, ShouldBeNil)
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 100*time.Millisecond)
+
+		_, err = r.Get(context.Background(), ts.URL+"/429", nil)
+		So(err, ShouldBeNil)
+		state = th.States()[u.Host]
+		So(state.Remaining, ShouldEqual, 0)
+		So(state.Reset, ShouldHappenAfter, time.Now().Add(9*time.Second))
+		So(strings.Contains(th.String(), `"limit":3`), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,139 @@
+package req
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings the timing breakdown of a request,
+// BodyTransfer and Total are known once the body is read or closed
+type Timings struct {
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	// FirstByte the time from the start of the request to the first
+	// response byte
+	FirstByte    time.Duration
+	BodyTransfer time.Duration
+	Total        time.Duration
+	// ConnReused whether the connection was reused from the pool
+	ConnReused bool
+}
+
+type tracer struct {
+	mu        sync.Mutex
+	start     time.Time
+	dnsStart  time.Time
+	dnsDone   time.Time
+	connStart time.Time
+	connDone  time.Time
+	tlsStart  time.Time
+	tlsDone   time.Time
+	firstByte time.Time
+	bodyDone  time.Time
+	reused    bool
+}
+
+func newTracer() *tracer {
+	return &tracer{start: time.Now()}
+}
+
+func (t *tracer) set(v *time.Time) {
+	t.mu.Lock()
+	*v = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *tracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			// restart the timings on every attempt
+			t.mu.Lock()
+			t.start = time.Now()
+			t.dnsStart, t.dnsDone = time.Time{}, time.Time{}
+			t.connStart, t.connDone = time.Time{}, time.Time{}
+			t.tlsStart, t.tlsDone = time.Time{}, time.Time{}
+			t.firstByte, t.bodyDone = time.Time{}, time.Time{}
+			t.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) { t.set(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.set(&t.dnsDone) },
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			if t.connStart.IsZero() {
+				t.connStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				t.set(&t.connDone)
+			}
+		},
+		TLSHandshakeStart:    func() { t.set(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.set(&t.tlsDone) },
+		GotFirstResponseByte: func() { t.set(&t.firstByte) },
+	}
+}
+
+func (t *tracer) done() {
+	t.mu.Lock()
+	if t.bodyDone.IsZero() {
+		t.bodyDone = time.Now()
+	}
+	t.mu.Unlock()
+}
+
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+func (t *tracer) timings() Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return Timings{
+		DNS:          between(t.dnsStart, t.dnsDone),
+		Connect:      between(t.connStart, t.connDone),
+		TLSHandshake: between(t.tlsStart, t.tlsDone),
+		FirstByte:    between(t.start, t.firstByte),
+		BodyTransfer: between(t.firstByte, t.bodyDone),
+		Total:        between(t.start, t.bodyDone),
+		ConnReused:   t.reused,
+	}
+}
+
+// traceBody records the end of the body transfer
+type traceBody struct {
+	io.ReadCloser
+	t *tracer
+}
+
+func (b *traceBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.t.done()
+	}
+	return n, err
+}
+
+func (b *traceBody) Close() error {
+	b.t.done()
+	return b.ReadCloser.Close()
+}
+
+func withTracer(req *http.Request, t *tracer) *http.Request {
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), t.clientTrace()))
+}
@@ -0,0 +1,40 @@
+package req
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTrace(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	Convey("Test Trace Request", t, func() {
+		r := New()
+
+		resp, err := r.Get(context.Background(), ts.URL, nil)
+		So(err, ShouldBeNil)
+		resp.String()
+		So(resp.Timings(), ShouldResemble, Timings{})
+
+		resp, err = r.Get(context.Background(), ts.URL, nil, SetRequestTrace())
+		So(err, ShouldBeNil)
+		So(resp.Timings().Total, ShouldEqual, 0)
+		_, err = resp.String()
+		So(err, ShouldBeNil)
+
+		tm := resp.Timings()
+		So(tm.ConnReused, ShouldBeTrue)
+		So(tm.FirstByte, ShouldBeGreaterThanOrEqualTo, 10*time.Millisecond)
+		So(tm.Total, ShouldBeGreaterThanOrEqualTo, tm.FirstByte)
+	})
+}